@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/crypto"
+	"github.com/spf13/cobra"
+)
+
+func newEncryptCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "encrypt [texto]",
+		Short: "Encripta un texto (o la contraseña de --pass) con AES-GCM",
+		Args:  usageArgs(cobra.MaximumNArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadCryptoConfig()
+			if err != nil {
+				return err
+			}
+
+			text := cfg.SMBPass
+			if len(args) == 1 {
+				text = args[0]
+			}
+			if text == "" {
+				return &usageError{fmt.Errorf("indique el texto a encriptar o use --pass")}
+			}
+
+			encrypted, err := cfg.EncryptString(text)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), encrypted)
+			return nil
+		},
+	}
+}
+
+func newDecryptCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "decrypt <texto>",
+		Short: "Desencripta un texto generado con encrypt",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := loadCryptoConfig(); err != nil {
+				return err
+			}
+
+			decrypted, err := crypto.DecryptString(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), decrypted)
+			return nil
+		},
+	}
+}
+
+// loadCryptoConfig loads the flags needed by encrypt and decrypt. Unlike push
+// it does not require SMB connection settings.
+func loadCryptoConfig() (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, &usageError{err}
+	}
+	if err := cfg.ApplyEncryptionKey(); err != nil {
+		return nil, &usageError{err}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+	"github.com/hvarillas/smbsync/internal/scheduler"
+	"github.com/hvarillas/smbsync/pkg/banner"
+	"github.com/spf13/cobra"
+)
+
+// defaultStatusFile is where the daemon writes the status of its jobs.
+const defaultStatusFile = "smbsync-status.json"
+
+func newDaemonCmd() *cobra.Command {
+	var (
+		file       string
+		statusPath string
+		statusAddr string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Ejecuta los trabajos del archivo YAML según su schedule cron",
+		Long: "Queda en ejecución y lanza cada trabajo con schedule del archivo de trabajos cuando corresponde. " +
+			"Un trabajo no se solapa consigo mismo. Con SIGTERM o Ctrl+C deja de programar ejecuciones y " +
+			"espera a que terminen los archivos en curso; una segunda señal detiene el proceso de inmediato.",
+		Args: usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobs, defaults, err := loadJobs(file, nil, true)
+			if err != nil {
+				return err
+			}
+			scheduled := scheduledJobs(jobs)
+			sched, err := scheduler.New(scheduled, runJob, statusPath)
+			if err != nil {
+				return &usageError{err}
+			}
+
+			banner.Print(os.Stdout)
+			logger.Init(defaults.LogPath, defaults.LogLevel)
+			defer logger.Sugar.Sync()
+
+			for _, job := range jobs {
+				if job.Schedule == "" {
+					logger.Sugar.Warnf("El trabajo %s no tiene schedule, el daemon no lo ejecutará", job.Name)
+				}
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			go func() {
+				<-ctx.Done()
+				// Restore the default handling so a second signal ends the
+				// process without waiting for the files in progress.
+				stop()
+			}()
+
+			if statusAddr != "" {
+				srv, err := serveStatus(statusAddr, sched)
+				if err != nil {
+					return err
+				}
+				defer srv.Shutdown(context.Background())
+			}
+
+			logger.Sugar.Infof("Daemon iniciado con %d trabajos programados", len(scheduled))
+			return sched.Run(ctx)
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", defaultJobsFile, "Jobs file")
+	cmd.Flags().StringVar(&statusPath, "status", defaultStatusFile, "File where the status of every job is written (empty to disable)")
+	cmd.Flags().StringVar(&statusAddr, "status-addr", "", "Serve the status of every job as JSON on this address, e.g. 127.0.0.1:8080")
+	return cmd
+}
+
+// scheduledJobs returns the jobs that have a schedule.
+func scheduledJobs(jobs []config.Job) []config.Job {
+	var scheduled []config.Job
+	for _, job := range jobs {
+		if job.Schedule != "" {
+			scheduled = append(scheduled, job)
+		}
+	}
+	return scheduled
+}
+
+// serveStatus serves the scheduler status on addr under /status.
+func serveStatus(addr string, sched *scheduler.Scheduler) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo escuchar en %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /status", sched)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Sugar.Errorf("El servidor de estado se detuvo: %v", err)
+		}
+	}()
+	logger.Sugar.Infof("Estado de los trabajos disponible en http://%s/status", ln.Addr())
+	return srv, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDaemon_UsageErrors(t *testing.T) {
+	file, dir := jobsFixture(t)
+
+	badSchedule := filepath.Join(dir, "bad.yaml")
+	writeFile(t, badSchedule, "jobs:\n  sql:\n    schedule: every night\n    target-dir: "+dir+"\n")
+
+	testCases := []struct {
+		name string
+		args []string
+	}{
+		{"no scheduled jobs", []string{"daemon", "-f", file}},
+		{"invalid schedule", []string{"daemon", "-f", badSchedule}},
+		{"unexpected argument", []string{"daemon", "-f", file, "sql"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := execute(tc.args...)
+			if got := exitCode(err); got != exitUsage {
+				t.Errorf("Expected exit code %d, got %d (err: %v)", exitUsage, got, err)
+			}
+		})
+	}
+	if _, err := os.Stat(defaultStatusFile); !os.IsNotExist(err) {
+		t.Errorf("Expected no status file to be written on usage errors, got %v", err)
+	}
+}
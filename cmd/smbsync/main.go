@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/smb"
+	"github.com/spf13/cobra"
+)
+
+// Process exit codes. Scripts and schedulers rely on these values, so they
+// must stay stable.
+const (
+	exitOK         = 0
+	exitFailure    = 1
+	exitUsage      = 2
+	exitConnection = 3
+	exitIncomplete = 4
+	exitMismatch   = 5
+)
+
+// version is overridden at build time with -ldflags "-X main.version=...".
+var version = "v1.0"
+
+// usageError marks errors caused by invalid flags, arguments or configuration.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string { return e.err.Error() }
+func (e *usageError) Unwrap() error { return e.err }
+
+func newRootCmd() *cobra.Command {
+	root := &cobra.Command{
+		Use:           "smbsync",
+		Short:         "Sincroniza archivos locales con recursos compartidos SMB",
+		Args:          usageArgs(cobra.NoArgs),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	root.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &usageError{err}
+	})
+	config.InitFlags(root)
+
+	root.AddCommand(
+		newPushCmd(),
+		newPullCmd(),
+		newVerifyCmd(),
+		newRunCmd(),
+		newWatchCmd(),
+		newDaemonCmd(),
+		newConfigCmd(),
+		newEncryptCmd(),
+		newDecryptCmd(),
+		newVersionCmd(),
+	)
+	return root
+}
+
+// usageArgs wraps a cobra positional argument validator so its failures map
+// to exitUsage.
+func usageArgs(validate cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := validate(cmd, args); err != nil {
+			return &usageError{err}
+		}
+		return nil
+	}
+}
+
+func exitCode(err error) int {
+	var uerr *usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &uerr):
+		return exitUsage
+	case errors.Is(err, smb.ErrConnection):
+		return exitConnection
+	case errors.Is(err, smb.ErrMismatch):
+		return exitMismatch
+	case errors.Is(err, smb.ErrIncomplete), errors.Is(err, smb.ErrInterrupted):
+		return exitIncomplete
+	default:
+		return exitFailure
+	}
+}
+
+func main() {
+	err := newRootCmd().Execute()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	os.Exit(exitCode(err))
+}
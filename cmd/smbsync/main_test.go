@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hvarillas/smbsync/internal/smb"
+)
+
+func execute(args ...string) (string, error) {
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestExitCode(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, exitOK},
+		{"generic", errors.New("boom"), exitFailure},
+		{"usage", &usageError{errors.New("bad flag")}, exitUsage},
+		{"connection", fmt.Errorf("%w: timeout", smb.ErrConnection), exitConnection},
+		{"incomplete", fmt.Errorf("%w: 1 of 2 failed", smb.ErrIncomplete), exitIncomplete},
+		{"failed job", errors.Join(fmt.Errorf("job sql: %w", smb.ErrIncomplete)), exitIncomplete},
+		{"interrupted", fmt.Errorf("%w: 3 of 5 not started", smb.ErrInterrupted), exitIncomplete},
+		{"mismatch", fmt.Errorf("%w: 1 changed, 0 missing, 0 without manifest", smb.ErrMismatch), exitMismatch},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exitCode(tc.err); got != tc.want {
+				t.Errorf("Expected exit code %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	const key = "1234567890123456"
+
+	out, err := execute("encrypt", "secreto", "--encryption-key", key)
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	encrypted := strings.TrimSpace(out)
+	if encrypted == "" || encrypted == "secreto" {
+		t.Fatalf("Unexpected encrypted output: %q", encrypted)
+	}
+
+	out, err = execute("decrypt", encrypted, "--encryption-key", key)
+	if err != nil {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	if got := strings.TrimSpace(out); got != "secreto" {
+		t.Errorf("Expected 'secreto', got %q", got)
+	}
+}
+
+func TestEncrypt_UsesPassFlag(t *testing.T) {
+	out, err := execute("encrypt", "--pass", "micontraseña")
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if strings.TrimSpace(out) == "" {
+		t.Error("Expected encrypted password on stdout")
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		args []string
+	}{
+		{"encrypt without text", []string{"encrypt"}},
+		{"decrypt without text", []string{"decrypt"}},
+		{"unknown flag", []string{"push", "--no-such-flag"}},
+		{"unknown command", []string{"pul"}},
+		{"invalid encryption key", []string{"encrypt", "x", "--encryption-key", "short"}},
+		{"push without host", []string{"push", "-u", "user", "-p", "pass", "-s", "share"}},
+		{"pull offline", []string{"pull", "--dry-run", "--offline", "-s", "share"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := execute(tc.args...)
+			if got := exitCode(err); got != exitUsage {
+				t.Errorf("Expected exit code %d, got %d (err: %v)", exitUsage, got, err)
+			}
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	out, err := execute("version")
+	if err != nil {
+		t.Fatalf("version failed: %v", err)
+	}
+	if !strings.Contains(out, version) {
+		t.Errorf("Expected output to contain %q, got %q", version, out)
+	}
+}
+
+func TestConfig_MasksSecrets(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("SMB_HOST", "envhost")
+
+	out, err := execute("config", "--pass", "supersecreta", "-u", "backup")
+	if err != nil {
+		t.Fatalf("config failed: %v", err)
+	}
+	if strings.Contains(out, "supersecreta") {
+		t.Error("Expected the password to be masked")
+	}
+	for _, want := range []string{"envhost", "backup"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestVerifyNoneWithDelete(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "local", "db.bak"), "db")
+	if err := os.MkdirAll(filepath.Join(dir, "target"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	flags := []string{"--path", filepath.Join(dir, "local"), "--target-dir", filepath.Join(dir, "target"), "-r", `\.bak$`, "--verify", "none", "--delete", "--log", filepath.Join(dir, "smbsync.log")}
+
+	_, err := execute(append([]string{"push"}, flags...)...)
+	if got := exitCode(err); got != exitUsage {
+		t.Errorf("Expected push to be rejected with exit code %d, got %d (err: %v)", exitUsage, got, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "local", "db.bak")); err != nil {
+		t.Errorf("Local file must be kept: %v", err)
+	}
+
+	// pull always verifies its copies, so --verify does not apply to it.
+	if _, err := execute(append([]string{"pull"}, flags...)...); err != nil {
+		t.Errorf("Expected pull to accept --verify none with --delete, got %v", err)
+	}
+}
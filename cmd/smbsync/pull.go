@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"github.com/hvarillas/smbsync/internal/logger"
+	"github.com/hvarillas/smbsync/internal/smb"
+	"github.com/hvarillas/smbsync/pkg/banner"
+	"github.com/spf13/cobra"
+)
+
+func newPullCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "pull",
+		Short: "Descarga, verifica y opcionalmente elimina archivos del recurso SMB",
+		Long: "Descarga a --path los archivos de --sharedPath que coinciden con --regex, " +
+			"verifica cada copia local con el hash de --hash y, con --delete, elimina el original remoto.",
+		Args: usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadValidConfig()
+			if err != nil {
+				return err
+			}
+			if cfg.Offline {
+				return &usageError{errors.New("pull no admite --offline: necesita listar el recurso compartido")}
+			}
+
+			banner.Print(os.Stdout)
+			logger.Init(cfg.LogPath, cfg.LogLevel)
+			defer logger.Sugar.Sync()
+
+			return smb.RunPull(cfg)
+		},
+	}
+}
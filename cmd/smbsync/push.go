@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+	"github.com/hvarillas/smbsync/internal/smb"
+	"github.com/hvarillas/smbsync/pkg/banner"
+	"github.com/spf13/cobra"
+)
+
+func newPushCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "push",
+		Short: "Copia, verifica y opcionalmente elimina archivos locales en el recurso SMB",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadValidPushConfig()
+			if err != nil {
+				return err
+			}
+
+			banner.Print(os.Stdout)
+			logger.Init(cfg.LogPath, cfg.LogLevel)
+			defer logger.Sugar.Sync()
+
+			return smb.RunHeadless(cfg)
+		},
+	}
+}
+
+// loadValidConfig loads the configuration from flags and validates it,
+// reporting any problem as a usage error.
+func loadValidConfig() (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, &usageError{err}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, &usageError{err}
+	}
+	return cfg, nil
+}
+
+// loadValidPushConfig is loadValidConfig for the commands that copy local
+// files to the destination.
+func loadValidPushConfig() (*config.Config, error) {
+	cfg, err := loadValidConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.ValidatePush(); err != nil {
+		return nil, &usageError{err}
+	}
+	return cfg, nil
+}
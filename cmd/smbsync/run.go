@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+	"github.com/hvarillas/smbsync/internal/smb"
+	"github.com/hvarillas/smbsync/pkg/banner"
+	"github.com/spf13/cobra"
+)
+
+// defaultJobsFile is read by run when --file is not given.
+const defaultJobsFile = "smbsync.yaml"
+
+func newRunCmd() *cobra.Command {
+	var (
+		file string
+		all  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "run [trabajo...]",
+		Short: "Ejecuta trabajos definidos en un archivo de configuración YAML",
+		Long: "Ejecuta, en orden, los trabajos indicados (o todos con --all) del archivo de trabajos. " +
+			"Si un trabajo falla se continúa con los siguientes.",
+		Args: usageArgs(func(cmd *cobra.Command, args []string) error {
+			if all && len(args) > 0 {
+				return fmt.Errorf("indica trabajos o --all, no ambos")
+			}
+			if !all && len(args) == 0 {
+				return fmt.Errorf("indica al menos un trabajo o --all")
+			}
+			return nil
+		}),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobs, defaults, err := loadJobs(file, args, all)
+			if err != nil {
+				return err
+			}
+
+			banner.Print(os.Stdout)
+			logger.Init(defaults.LogPath, defaults.LogLevel)
+			defer logger.Sugar.Sync()
+
+			var errs []error
+			for _, job := range jobs {
+				logger.Sugar.Infof("Ejecutando trabajo %s (%s)", job.Name, job.Command)
+				if err := runJob(cmd.Context(), job); err != nil {
+					logger.Sugar.Errorf("El trabajo %s terminó con errores: %v", job.Name, err)
+					errs = append(errs, fmt.Errorf("job %s: %w", job.Name, err))
+					continue
+				}
+				logger.Sugar.Infof("Trabajo %s completado", job.Name)
+			}
+			return errors.Join(errs...)
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", defaultJobsFile, "Jobs file")
+	cmd.Flags().BoolVar(&all, "all", false, "Run every job of the file")
+	return cmd
+}
+
+// loadJobs reads the jobs file and returns the selected jobs, each validated,
+// together with the defaults used for logging.
+func loadJobs(file string, names []string, all bool) ([]config.Job, *config.Config, error) {
+	base, err := config.Load()
+	if err != nil {
+		return nil, nil, &usageError{err}
+	}
+	jobsFile, err := config.LoadJobs(file, base)
+	if err != nil {
+		return nil, nil, &usageError{err}
+	}
+
+	jobs := jobsFile.Jobs
+	if !all {
+		jobs = nil
+		for _, name := range names {
+			job, ok := jobsFile.Job(name)
+			if !ok {
+				return nil, nil, &usageError{fmt.Errorf("el trabajo %s no existe en %s", name, file)}
+			}
+			jobs = append(jobs, job)
+		}
+	}
+
+	for _, job := range jobs {
+		if err := job.Config.Validate(); err != nil {
+			return nil, nil, &usageError{fmt.Errorf("trabajo %s: %w", job.Name, err)}
+		}
+		if job.Command == config.JobPush {
+			if err := job.Config.ValidatePush(); err != nil {
+				return nil, nil, &usageError{fmt.Errorf("trabajo %s: %w", job.Name, err)}
+			}
+		}
+	}
+	return jobs, jobsFile.Defaults, nil
+}
+
+// runJob runs job with the command it was configured for.
+func runJob(ctx context.Context, job config.Job) error {
+	switch job.Command {
+	case config.JobPull:
+		return smb.RunPullContext(ctx, job.Config)
+	case config.JobVerify:
+		return smb.RunVerify(ctx, job.Config)
+	}
+	return smb.RunHeadlessContext(ctx, job.Config)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+// jobsFixture writes a jobs file with two jobs copying to local directories.
+func jobsFixture(t *testing.T) (file, dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	writeFile(t, filepath.Join(dir, "sql", "db.bak"), "db")
+	writeFile(t, filepath.Join(dir, "logs", "app.log"), "log")
+	if err := os.MkdirAll(filepath.Join(dir, "target"), 0755); err != nil {
+		t.Fatalf("Failed to create target: %v", err)
+	}
+
+	t.Setenv("SMBSYNC_TEST_DIR", dir)
+	file = filepath.Join(dir, "smbsync.yaml")
+	writeFile(t, file, `
+defaults:
+  target-dir: ${SMBSYNC_TEST_DIR}/target
+  log: ${SMBSYNC_TEST_DIR}/smbsync.log
+  retries: 0
+jobs:
+  sql:
+    path: ${SMBSYNC_TEST_DIR}/sql
+    regex: '\.bak$'
+  logs:
+    path: ${SMBSYNC_TEST_DIR}/logs
+    regex: '\.log$'
+`)
+	return file, dir
+}
+
+func TestRun_SelectedJob(t *testing.T) {
+	file, dir := jobsFixture(t)
+
+	if _, err := execute("run", "-f", file, "sql"); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "target", "db.bak")); err != nil {
+		t.Errorf("Expected db.bak to be copied, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "target", "app.log")); !os.IsNotExist(err) {
+		t.Errorf("Expected the logs job not to run, got %v", err)
+	}
+}
+
+func TestRun_All(t *testing.T) {
+	file, dir := jobsFixture(t)
+
+	if _, err := execute("run", "-f", file, "--all"); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	for _, name := range []string{"db.bak", "app.log"} {
+		if _, err := os.Stat(filepath.Join(dir, "target", name)); err != nil {
+			t.Errorf("Expected %s to be copied, got %v", name, err)
+		}
+	}
+}
+
+func TestRun_FlagsOverrideJobs(t *testing.T) {
+	file, dir := jobsFixture(t)
+	writeFile(t, file, `
+defaults:
+  target-dir: ${SMBSYNC_TEST_DIR}/target
+  log: ${SMBSYNC_TEST_DIR}/smbsync.log
+  retries: 0
+  delete: true
+jobs:
+  sql:
+    path: ${SMBSYNC_TEST_DIR}/sql
+    regex: '\.bak$'
+    delete: true
+`)
+
+	if _, err := execute("run", "-f", file, "sql", "--delete=false"); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "target", "db.bak")); err != nil {
+		t.Errorf("Expected db.bak to be copied, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sql", "db.bak")); err != nil {
+		t.Errorf("Expected --delete=false to keep the source, got %v", err)
+	}
+}
+
+func TestRun_UsageErrors(t *testing.T) {
+	file, _ := jobsFixture(t)
+
+	testCases := []struct {
+		name string
+		args []string
+	}{
+		{"no job", []string{"run", "-f", file}},
+		{"job and all", []string{"run", "-f", file, "--all", "sql"}},
+		{"unknown job", []string{"run", "-f", file, "web"}},
+		{"missing file", []string{"run", "-f", file + ".missing", "--all"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := execute(tc.args...)
+			if got := exitCode(err); got != exitUsage {
+				t.Errorf("Expected exit code %d, got %d (err: %v)", exitUsage, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func newConfigCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "config",
+		Short: "Muestra la configuración efectiva y de dónde proviene cada valor",
+		Long: "Muestra la configuración resultante de combinar, en orden de prioridad creciente, " +
+			"los valores por defecto, el archivo .env, las variables de entorno y los flags. " +
+			"Las contraseñas y claves se muestran enmascaradas.",
+		Args: usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return &usageError{err}
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NOMBRE\tVALOR\tORIGEN")
+			for _, s := range cfg.Settings() {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, s.Value, s.Source)
+			}
+			return w.Flush()
+		},
+	}
+}
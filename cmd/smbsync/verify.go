@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/hvarillas/smbsync/internal/logger"
+	"github.com/hvarillas/smbsync/internal/smb"
+	"github.com/hvarillas/smbsync/pkg/banner"
+	"github.com/spf13/cobra"
+)
+
+func newVerifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "Relee los archivos remotos y los compara con sus manifiestos de hash",
+		Long: "Relee los archivos de --sharedPath que coinciden con --regex y compara su hash " +
+			"con el de los manifiestos escritos por push con --manifest, usando el algoritmo " +
+			"con el que se registró cada uno. Informa de los archivos " +
+			"modificados, de los que faltan y de los que no figuran en ningún manifiesto, y en " +
+			"ese caso termina con el código 5.",
+		Args: usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadValidConfig()
+			if err != nil {
+				return err
+			}
+
+			banner.Print(os.Stdout)
+			logger.Init(cfg.LogPath, cfg.LogLevel)
+			defer logger.Sugar.Sync()
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return smb.RunVerify(ctx, cfg)
+		},
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/hvarillas/smbsync/internal/logger"
+	"github.com/hvarillas/smbsync/internal/smb"
+	"github.com/hvarillas/smbsync/pkg/banner"
+	"github.com/spf13/cobra"
+)
+
+func newWatchCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "watch",
+		Short: "Vigila --path y copia cada archivo nuevo en cuanto termina de escribirse",
+		Long: "Copia primero los archivos que ya coinciden con --regex y luego vigila --path. " +
+			"Cada archivo nuevo o modificado se copia cuando no cambia durante --stable-for " +
+			"y ningún otro proceso lo tiene bloqueado. Se detiene con Ctrl+C o SIGTERM.",
+		Args: usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadValidPushConfig()
+			if err != nil {
+				return err
+			}
+			if cfg.DryRun {
+				return &usageError{errors.New("watch no admite --dry-run")}
+			}
+			if cfg.Bundle != "" {
+				return &usageError{errors.New("watch no admite --bundle")}
+			}
+
+			banner.Print(os.Stdout)
+			logger.Init(cfg.LogPath, cfg.LogLevel)
+			defer logger.Sugar.Sync()
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return smb.RunWatch(ctx, cfg)
+		},
+	}
+}
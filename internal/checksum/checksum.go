@@ -0,0 +1,79 @@
+// Package checksum provides the hash algorithms used to verify copies.
+package checksum
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strings"
+
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
+)
+
+// Names of the supported algorithms, as accepted by --hash.
+const (
+	SHA256 = "sha256"
+	SHA512 = "sha512"
+	BLAKE3 = "blake3"
+	XXH3   = "xxh3"
+	CRC32C = "crc32c"
+)
+
+// Default is the algorithm used when none is configured.
+const Default = SHA256
+
+// Hasher is a hash algorithm that copies can be verified with.
+type Hasher interface {
+	// Name is the name of the algorithm in upper case (SHA256, BLAKE3...),
+	// as recorded in reports and manifests.
+	Name() string
+	// New returns a new hash of this algorithm.
+	New() hash.Hash
+}
+
+type hasher struct {
+	name    string
+	newHash func() hash.Hash
+}
+
+func (h hasher) Name() string   { return h.name }
+func (h hasher) New() hash.Hash { return h.newHash() }
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// hashers lists the algorithms in the order they are documented: the
+// cryptographic ones first, then the fast checksums that only detect
+// accidental corruption.
+var hashers = []hasher{
+	{"SHA256", sha256.New},
+	{"SHA512", sha512.New},
+	{"BLAKE3", func() hash.Hash { return blake3.New() }},
+	{"XXH3", func() hash.Hash { return xxh3.New() }},
+	{"CRC32C", func() hash.Hash { return crc32.New(castagnoli) }},
+}
+
+// Get returns the algorithm called name, in any case. The empty name selects
+// Default.
+func Get(name string) (Hasher, error) {
+	if name == "" {
+		name = Default
+	}
+	for _, h := range hashers {
+		if strings.EqualFold(h.name, name) {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown hash algorithm %q (supported: %s)", name, strings.Join(Names(), ", "))
+}
+
+// Names returns the names accepted by Get, in lower case.
+func Names() []string {
+	names := make([]string, len(hashers))
+	for i, h := range hashers {
+		names[i] = strings.ToLower(h.name)
+	}
+	return names
+}
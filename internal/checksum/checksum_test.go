@@ -0,0 +1,45 @@
+package checksum
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		// sum is the hash of "abc".
+		sum string
+	}{
+		{"", "SHA256", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"sha256", "SHA256", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"SHA512", "SHA512", "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"},
+		{"blake3", "BLAKE3", "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+		{"xxh3", "XXH3", "78af5f94892f3950"},
+		{"Crc32c", "CRC32C", "364b3fb7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			h, err := Get(tt.name)
+			if err != nil {
+				t.Fatalf("Get(%q) failed: %v", tt.name, err)
+			}
+			if h.Name() != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, h.Name())
+			}
+			sum := h.New()
+			sum.Write([]byte("abc"))
+			if got := hex.EncodeToString(sum.Sum(nil)); got != tt.sum {
+				t.Errorf("Expected %s, got %s", tt.sum, got)
+			}
+		})
+	}
+}
+
+func TestGet_Unknown(t *testing.T) {
+	if _, err := Get("md5"); err == nil {
+		t.Error("Expected error for an unsupported algorithm")
+	}
+}
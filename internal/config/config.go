@@ -2,55 +2,365 @@ package config
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/hvarillas/smbsync/internal/checksum"
 	"github.com/hvarillas/smbsync/internal/crypto"
+	"github.com/hvarillas/smbsync/internal/report"
+	"github.com/hvarillas/smbsync/internal/retention"
+	"github.com/hvarillas/smbsync/internal/throttle"
 	"github.com/spf13/cobra"
 )
 
+// DefaultResumeState is the default location of the resume journal.
+const DefaultResumeState = "smbsync-resume.json"
+
+// Comparison modes used by incremental runs to decide whether a remote file
+// is already up to date.
+const (
+	CompareMTime = "mtime"
+	CompareHash  = "hash"
+)
+
+// Verification modes: reread the whole copy, compare a few sampled blocks
+// with the source, or trust the transfer.
+const (
+	VerifyFull   = "full"
+	VerifySample = "sample"
+	VerifyNone   = "none"
+)
+
+// DefaultVerifySamples is the number of blocks compared in sample mode.
+const DefaultVerifySamples = 8
+
+// Policies applied when the destination file already exists.
+const (
+	ConflictOverwrite = "overwrite"
+	ConflictSkip      = "skip"
+	ConflictRename    = "rename"
+	ConflictFail      = "fail"
+	ConflictNewer     = "newer"
+)
+
+// Manifest layouts: a .sha256 file next to each uploaded file, or one
+// SHA256SUMS file per remote directory.
+const (
+	ManifestSidecar = "sidecar"
+	ManifestDir     = "dir"
+)
+
+// Compression formats accepted by --compress. Each one is also the extension
+// of the compressed copy.
+const (
+	CompressZip    = "zip"
+	CompressTarGz  = "tar.gz"
+	CompressTarZst = "tar.zst"
+	CompressXz     = "xz"
+)
+
+// Bundle groupings: one archive per run, per day of modification or per
+// source directory.
+const (
+	BundleRun = "run"
+	BundleDay = "day"
+	BundleDir = "dir"
+)
+
 type Config struct {
-	SMBUser        string
-	SMBPass        string
-	SMBHost        string
-	Regex          string
-	Path           string
-	Shared         string
-	SharedPath     string
-	DeleteAfter    bool
-	Zippy          bool
-	LogPath        string
-	LogLevel       string
-	EncryptedPass  string
-	GenerateCrypto bool
-	EncryptText    string
-	EncryptionKey  string
+	SMBUser         string        `yaml:"user"`
+	SMBPass         string        `yaml:"pass"`
+	SMBHost         string        `yaml:"host"`
+	Regex           string        `yaml:"regex"`
+	Path            string        `yaml:"path"`
+	Shared          string        `yaml:"shared"`
+	SharedPath      string        `yaml:"sharedPath"`
+	DeleteAfter     bool          `yaml:"delete"`
+	Zippy           bool          `yaml:"zip"`
+	LogPath         string        `yaml:"log"`
+	LogLevel        string        `yaml:"log-level"`
+	EncryptedPass   string        `yaml:"encrypted-pass"`
+	EncryptionKey   string        `yaml:"encryption-key"`
+	TargetDir       string        `yaml:"target-dir"`
+	Recursive       bool          `yaml:"recursive"`
+	MaxDepth        int           `yaml:"max-depth"`
+	SkipHidden      bool          `yaml:"exclude-hidden"`
+	Resume          bool          `yaml:"resume"`
+	ResumeState     string        `yaml:"resume-state"`
+	Concurrency     int           `yaml:"concurrency"`
+	Incremental     bool          `yaml:"incremental"`
+	CompareMode     string        `yaml:"compare"`
+	OnConflict      string        `yaml:"on-conflict"`
+	DryRun          bool          `yaml:"dry-run"`
+	Offline         bool          `yaml:"offline"`
+	Report          string        `yaml:"report"`
+	ReportFormat    string        `yaml:"report-format"`
+	Retries         int           `yaml:"retries"`
+	RetryDelay      time.Duration `yaml:"retry-delay"`
+	RetryMaxDelay   time.Duration `yaml:"retry-max-delay"`
+	RetryJitter     float64       `yaml:"retry-jitter"`
+	BWLimit         string        `yaml:"bwlimit"`
+	BWSchedule      string        `yaml:"bwlimit-schedule"`
+	StableFor       time.Duration `yaml:"stable-for"`
+	Keepalive       time.Duration `yaml:"keepalive"`
+	KeepLast        int           `yaml:"keep-last"`
+	KeepWithin      string        `yaml:"keep-within"`
+	KeepDaily       int           `yaml:"keep-daily"`
+	KeepWeekly      int           `yaml:"keep-weekly"`
+	KeepMonthly     int           `yaml:"keep-monthly"`
+	KeepRegex       string        `yaml:"keep-regex"`
+	LocalKeepLast   int           `yaml:"local-keep-last"`
+	LocalKeepWithin string        `yaml:"local-keep-within"`
+	Manifest        string        `yaml:"manifest"`
+	Hash            string        `yaml:"hash"`
+	VerifyMode      string        `yaml:"verify"`
+	VerifySamples   int           `yaml:"verify-samples"`
+	Bundle          string        `yaml:"bundle"`
+	Compress        string        `yaml:"compress"`
+	CompressLevel   int           `yaml:"compress-level"`
+	CompressThreads int           `yaml:"compress-threads"`
+
+	// sources records where each setting came from, by flag name.
+	sources map[string]string
 }
 
+// Load resolves the configuration from, in increasing precedence, the flag
+// defaults, the .env file, SMB_* environment variables and the flags given on
+// the command line.
 func Load() (*Config, error) {
+	sources, err := resolveLayers()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
-		SMBUser:        smbUser,
-		SMBPass:        smbPass,
-		SMBHost:        smbHost,
-		Regex:          regex,
-		Path:           path,
-		Shared:         shared,
-		SharedPath:     sharedPath,
-		DeleteAfter:    deleteAfter,
-		Zippy:          zippy,
-		LogPath:        logPath,
-		LogLevel:       logLevel,
-		EncryptedPass:  encryptedPass,
-		GenerateCrypto: generateCrypto,
-		EncryptText:    encryptText,
-		EncryptionKey:  encryptionKey,
+		SMBUser:         smbUser,
+		SMBPass:         smbPass,
+		SMBHost:         smbHost,
+		Regex:           regex,
+		Path:            path,
+		Shared:          shared,
+		SharedPath:      sharedPath,
+		DeleteAfter:     deleteAfter,
+		Zippy:           zippy,
+		LogPath:         logPath,
+		LogLevel:        logLevel,
+		EncryptedPass:   encryptedPass,
+		EncryptionKey:   encryptionKey,
+		TargetDir:       targetDir,
+		Recursive:       recursive,
+		MaxDepth:        maxDepth,
+		SkipHidden:      skipHidden,
+		Resume:          resume,
+		ResumeState:     resumeState,
+		Concurrency:     concurrency,
+		Incremental:     incremental,
+		CompareMode:     compareMode,
+		OnConflict:      onConflict,
+		DryRun:          dryRun,
+		Offline:         offline,
+		Report:          reportPath,
+		ReportFormat:    reportFormat,
+		Retries:         retries,
+		RetryDelay:      retryDelay,
+		RetryMaxDelay:   retryMaxDelay,
+		RetryJitter:     retryJitter,
+		BWLimit:         bwLimit,
+		BWSchedule:      bwSchedule,
+		StableFor:       stableFor,
+		Keepalive:       keepalive,
+		KeepLast:        keepLast,
+		KeepWithin:      keepWithin,
+		KeepDaily:       keepDaily,
+		KeepWeekly:      keepWeekly,
+		KeepMonthly:     keepMonthly,
+		KeepRegex:       keepRegex,
+		LocalKeepLast:   localKeepLast,
+		LocalKeepWithin: localKeepWithin,
+		Manifest:        manifest,
+		Hash:            hashAlgorithm,
+		VerifyMode:      verifyMode,
+		VerifySamples:   verifySamples,
+		Bundle:          bundle,
+		Compress:        compress,
+		CompressLevel:   compressLevel,
+		CompressThreads: compressThreads,
+		sources:         sources,
 	}, nil
 }
 
+// CompressFormat returns the format files are compressed with before the
+// upload, or "" when they are copied as they are. --zip is --compress zip.
+func (c *Config) CompressFormat() string {
+	if c.Compress == "" && c.Zippy {
+		return CompressZip
+	}
+	return c.Compress
+}
+
+// compressLevels is the range of --compress-level of each format.
+var compressLevels = map[string][2]int{
+	CompressZip:    {1, 9},
+	CompressTarGz:  {1, 9},
+	CompressTarZst: {1, 22},
+	CompressXz:     {1, 9},
+}
+
+// RetentionPolicy returns the rules used to prune old remote files. The policy
+// is disabled when no keep-* setting is given.
+func (c *Config) RetentionPolicy() (retention.Policy, error) {
+	within, err := retention.ParseAge(c.KeepWithin)
+	if err != nil {
+		return retention.Policy{}, fmt.Errorf("keep-within inválido: %w", err)
+	}
+	policy := retention.Policy{
+		Last:    c.KeepLast,
+		Within:  within,
+		Daily:   c.KeepDaily,
+		Weekly:  c.KeepWeekly,
+		Monthly: c.KeepMonthly,
+	}
+	if err := policy.Validate(); err != nil {
+		return retention.Policy{}, fmt.Errorf("keep-last, keep-daily, keep-weekly y keep-monthly no pueden ser negativos")
+	}
+	return policy, nil
+}
+
+// LocalRetentionPolicy returns the rules that decide which verified local
+// files --delete removes. When it is disabled --delete removes every file as
+// soon as its copy is verified.
+func (c *Config) LocalRetentionPolicy() (retention.Policy, error) {
+	within, err := retention.ParseAge(c.LocalKeepWithin)
+	if err != nil {
+		return retention.Policy{}, fmt.Errorf("local-keep-within inválido: %w", err)
+	}
+	if c.LocalKeepLast < 0 {
+		return retention.Policy{}, fmt.Errorf("local-keep-last no puede ser negativo")
+	}
+	return retention.Policy{Last: c.LocalKeepLast, Within: within}, nil
+}
+
+// ApplyEncryptionKey registers the configured AES key, if any, so crypto uses it
+// instead of ENCRYPTION_KEY or the built-in default.
+func (c *Config) ApplyEncryptionKey() error {
+	if c.EncryptionKey == "" {
+		return nil
+	}
+	if len(c.EncryptionKey) != 16 {
+		return fmt.Errorf("la clave de encriptación debe tener exactamente 16 bytes")
+	}
+	crypto.SetEncryptionKey(c.EncryptionKey)
+	return nil
+}
+
 func (c *Config) Validate() error {
-	if c.EncryptionKey != "" {
-		if len(c.EncryptionKey) != 16 {
-			return fmt.Errorf("la clave de encriptación debe tener exactamente 16 bytes")
+	if err := c.ApplyEncryptionKey(); err != nil {
+		return err
+	}
+
+	if c.MaxDepth < 0 {
+		return fmt.Errorf("max-depth no puede ser negativo")
+	}
+
+	if c.Concurrency < 0 {
+		return fmt.Errorf("concurrency no puede ser negativo")
+	}
+
+	switch c.CompareMode {
+	case "", CompareMTime, CompareHash:
+	default:
+		return fmt.Errorf("compare debe ser %q o %q", CompareMTime, CompareHash)
+	}
+
+	switch c.OnConflict {
+	case "", ConflictOverwrite, ConflictSkip, ConflictRename, ConflictFail, ConflictNewer:
+	default:
+		return fmt.Errorf("on-conflict debe ser overwrite, skip, rename, fail o newer")
+	}
+
+	if c.Retries < 0 || c.RetryDelay < 0 || c.RetryMaxDelay < 0 {
+		return fmt.Errorf("retries, retry-delay y retry-max-delay no pueden ser negativos")
+	}
+
+	if c.StableFor < 0 || c.Keepalive < 0 {
+		return fmt.Errorf("stable-for y keepalive no pueden ser negativos")
+	}
+
+	if c.RetryJitter < 0 || c.RetryJitter > 1 {
+		return fmt.Errorf("retry-jitter debe estar entre 0 y 1")
+	}
+
+	if c.BWLimit != "" {
+		if _, err := throttle.ParseRate(c.BWLimit); err != nil {
+			return fmt.Errorf("bwlimit inválido: %w", err)
 		}
-		crypto.SetEncryptionKey(c.EncryptionKey)
+	}
+
+	if c.BWSchedule != "" {
+		if c.BWLimit == "" {
+			return fmt.Errorf("bwlimit-schedule requiere bwlimit")
+		}
+		if _, err := throttle.ParseSchedule(c.BWSchedule); err != nil {
+			return fmt.Errorf("bwlimit-schedule inválido: %w", err)
+		}
+	}
+
+	if _, err := c.RetentionPolicy(); err != nil {
+		return err
+	}
+
+	localPolicy, err := c.LocalRetentionPolicy()
+	if err != nil {
+		return err
+	}
+	if localPolicy.Enabled() && !c.DeleteAfter {
+		return fmt.Errorf("local-keep-last y local-keep-within requieren delete")
+	}
+
+	switch c.Manifest {
+	case "", ManifestSidecar, ManifestDir:
+	default:
+		return fmt.Errorf("manifest debe ser %q o %q", ManifestSidecar, ManifestDir)
+	}
+
+	switch c.VerifyMode {
+	case "", VerifyFull, VerifySample, VerifyNone:
+	default:
+		return fmt.Errorf("verify debe ser %q, %q o %q", VerifyFull, VerifySample, VerifyNone)
+	}
+
+	if c.VerifySamples < 0 {
+		return fmt.Errorf("verify-samples no puede ser negativo")
+	}
+
+	switch c.Bundle {
+	case "", BundleRun, BundleDay, BundleDir:
+	default:
+		return fmt.Errorf("bundle debe ser %q, %q o %q", BundleRun, BundleDay, BundleDir)
+	}
+	if c.Bundle != "" && (c.CompressFormat() != "" || c.Resume || c.Incremental) {
+		return fmt.Errorf("bundle no puede combinarse con zip, compress, resume ni incremental")
+	}
+
+	if err := c.validateCompression(); err != nil {
+		return err
+	}
+
+	if _, err := checksum.Get(c.Hash); err != nil {
+		return fmt.Errorf("hash debe ser %s", strings.Join(checksum.Names(), ", "))
+	}
+
+	if !report.ValidFormat(c.ReportFormat) {
+		return fmt.Errorf("report-format debe ser json, csv o html")
+	}
+
+	if c.Offline && !c.DryRun {
+		return fmt.Errorf("offline solo puede usarse junto con dry-run")
+	}
+
+	// An offline dry run never connects, so it needs no destination settings.
+	if c.TargetDir != "" || c.Offline {
+		return nil
 	}
 
 	if c.SMBUser == "" || (c.SMBPass == "" && c.EncryptedPass == "") || c.SMBHost == "" || c.Shared == "" {
@@ -68,6 +378,41 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+func (c *Config) validateCompression() error {
+	format := c.CompressFormat()
+	if c.Zippy && format != CompressZip {
+		return fmt.Errorf("zip no puede combinarse con compress %q", c.Compress)
+	}
+	if format == "" && c.Bundle != "" {
+		// Bundles are zip archives and take --compress-level.
+		format = CompressZip
+	}
+
+	levels, ok := compressLevels[format]
+	switch {
+	case format != "" && !ok:
+		return fmt.Errorf("compress debe ser %q, %q, %q o %q", CompressZip, CompressTarGz, CompressTarZst, CompressXz)
+	case c.CompressLevel != 0 && format == "":
+		return fmt.Errorf("compress-level requiere compress, zip o bundle")
+	case c.CompressLevel != 0 && (c.CompressLevel < levels[0] || c.CompressLevel > levels[1]):
+		return fmt.Errorf("compress-level de %s debe estar entre %d y %d", format, levels[0], levels[1])
+	case c.CompressThreads < 0:
+		return fmt.Errorf("compress-threads no puede ser negativo")
+	case c.CompressThreads != 0 && format != CompressTarZst:
+		return fmt.Errorf("compress-threads solo se aplica a compress %q", CompressTarZst)
+	}
+	return nil
+}
+
+// ValidatePush checks the settings that only matter to the commands that copy
+// local files to the destination: push, watch and push jobs.
+func (c *Config) ValidatePush() error {
+	if c.VerifyMode == VerifyNone && c.DeleteAfter {
+		return fmt.Errorf("verify none no puede combinarse con delete: los originales solo se eliminan tras verificar su copia")
+	}
+	return nil
+}
+
 func (c *Config) EncryptPassword() (string, error) {
 	return crypto.EncryptPassword(c.SMBPass)
 }
@@ -77,37 +422,112 @@ func (c *Config) EncryptString(text string) (string, error) {
 }
 
 var (
-	smbUser        string
-	smbPass        string
-	smbHost        string
-	regex          string
-	path           string
-	shared         string
-	sharedPath     string
-	deleteAfter    bool
-	zippy          bool
-	logPath        string
-	logLevel       string
-	encryptedPass  string
-	generateCrypto bool
-	encryptText    string
-	encryptionKey  string
+	smbUser         string
+	smbPass         string
+	smbHost         string
+	regex           string
+	path            string
+	shared          string
+	sharedPath      string
+	deleteAfter     bool
+	zippy           bool
+	logPath         string
+	logLevel        string
+	encryptedPass   string
+	encryptionKey   string
+	targetDir       string
+	recursive       bool
+	maxDepth        int
+	skipHidden      bool
+	resume          bool
+	resumeState     string
+	concurrency     int
+	incremental     bool
+	compareMode     string
+	onConflict      string
+	dryRun          bool
+	offline         bool
+	reportPath      string
+	reportFormat    string
+	retries         int
+	retryDelay      time.Duration
+	retryMaxDelay   time.Duration
+	retryJitter     float64
+	bwLimit         string
+	bwSchedule      string
+	stableFor       time.Duration
+	keepalive       time.Duration
+	keepLast        int
+	keepWithin      string
+	keepDaily       int
+	keepWeekly      int
+	keepMonthly     int
+	keepRegex       string
+	localKeepLast   int
+	localKeepWithin string
+	manifest        string
+	hashAlgorithm   string
+	verifyMode      string
+	verifySamples   int
+	bundle          string
+	compress        string
+	compressLevel   int
+	compressThreads int
+	envFile         string
 )
 
 func InitFlags(cmd *cobra.Command) {
+	flagSet = cmd.PersistentFlags()
+	cmd.PersistentFlags().StringVar(&envFile, "env-file", DefaultEnvFile, "File with SMB_* variables loaded before the environment")
 	cmd.PersistentFlags().StringVarP(&smbUser, "user", "u", "", "SMB user name (required)")
 	cmd.PersistentFlags().StringVarP(&smbPass, "pass", "p", "", "SMB password (required if encrypted-pass not provided)")
 	cmd.PersistentFlags().StringVar(&smbHost, "host", "", "SMB host (required)")
 	cmd.PersistentFlags().StringVar(&encryptedPass, "encrypted-pass", "", "Encrypted SMB password (alternative to --pass)")
-	cmd.PersistentFlags().BoolVar(&generateCrypto, "generate-encrypted", false, "Generate encrypted password from --pass flag")
-	cmd.PersistentFlags().StringVar(&encryptText, "encrypt-text", "", "Encrypt any string using AES-GCM")
 	cmd.PersistentFlags().StringVar(&encryptionKey, "encryption-key", "", "16-byte encryption key for AES (overrides ENCRYPTION_KEY env var)")
 	cmd.PersistentFlags().StringVarP(&shared, "shared", "s", "", "Shared resource SMB (required)")
 	cmd.PersistentFlags().StringVarP(&regex, "regex", "r", "", "Regex to filter local files")
 	cmd.PersistentFlags().StringVarP(&path, "path", "", ".", "Base path for local files to copy")
 	cmd.PersistentFlags().StringVarP(&sharedPath, "sharedPath", "", ".", "Relative destination path on the share")
+	cmd.PersistentFlags().StringVar(&targetDir, "target-dir", "", "Local directory used in place of an SMB share")
+	cmd.PersistentFlags().BoolVarP(&recursive, "recursive", "R", false, "Walk subdirectories of --path and recreate them under --sharedPath")
+	cmd.PersistentFlags().IntVar(&maxDepth, "max-depth", 0, "Maximum directory depth below --path in recursive mode (0 = unlimited)")
+	cmd.PersistentFlags().BoolVar(&skipHidden, "exclude-hidden", false, "Skip hidden and system directories in recursive mode")
 	cmd.PersistentFlags().BoolVarP(&deleteAfter, "delete", "d", false, "Delete local file after successful verification")
-	cmd.PersistentFlags().BoolVarP(&zippy, "zip", "z", false, "Compress files before copying")
+	cmd.PersistentFlags().BoolVar(&resume, "resume", false, "Resume partially transferred files after a dropped connection or restart")
+	cmd.PersistentFlags().StringVar(&resumeState, "resume-state", DefaultResumeState, "Path to the journal that tracks partial transfers")
+	cmd.PersistentFlags().IntVarP(&concurrency, "concurrency", "j", 1, "Number of files copied and verified in parallel")
+	cmd.PersistentFlags().BoolVar(&incremental, "incremental", false, "Skip files whose remote copy is already up to date")
+	cmd.PersistentFlags().StringVar(&compareMode, "compare", CompareMTime, "How incremental runs detect unchanged files (mtime: size and modification time, hash: the --hash of both copies)")
+	cmd.PersistentFlags().StringVar(&onConflict, "on-conflict", ConflictOverwrite, "What to do when the remote file exists (overwrite, skip, rename, fail, newer)")
+	cmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Show what would be copied, skipped and deleted without writing anything")
+	cmd.PersistentFlags().BoolVar(&offline, "offline", false, "With --dry-run, plan without connecting to the destination")
+	cmd.PersistentFlags().StringVar(&reportPath, "report", "", "Write a per-file report of the run to this path")
+	cmd.PersistentFlags().StringVar(&reportFormat, "report-format", "", "Report format: json, csv or html (default: from the report file extension)")
+	cmd.PersistentFlags().IntVar(&retries, "retries", 3, "Times a file or connection is retried after a transient network error")
+	cmd.PersistentFlags().DurationVar(&retryDelay, "retry-delay", 2*time.Second, "Wait before the first retry; doubled on every further retry")
+	cmd.PersistentFlags().DurationVar(&retryMaxDelay, "retry-max-delay", time.Minute, "Maximum wait between retries")
+	cmd.PersistentFlags().Float64Var(&retryJitter, "retry-jitter", 0.2, "Random spread applied to retry waits, as a fraction (0-1)")
+	cmd.PersistentFlags().StringVar(&bwLimit, "bwlimit", "", "Maximum transfer rate for the whole run, e.g. 512K or 10M (bytes per second)")
+	cmd.PersistentFlags().StringVar(&bwSchedule, "bwlimit-schedule", "", "Only apply --bwlimit in these windows, e.g. \"Mon-Fri 08:00-18:00\"")
+	cmd.PersistentFlags().DurationVar(&stableFor, "stable-for", 10*time.Second, "In watch mode, how long a file must stay unchanged before it is copied")
+	cmd.PersistentFlags().DurationVar(&keepalive, "keepalive", time.Minute, "In watch mode, how often the idle destination connection is checked")
+	cmd.PersistentFlags().IntVar(&keepLast, "keep-last", 0, "After a successful push, keep only the newest N remote files of each series")
+	cmd.PersistentFlags().StringVar(&keepWithin, "keep-within", "", "After a successful push, keep remote files younger than this age, e.g. 30d")
+	cmd.PersistentFlags().IntVar(&keepDaily, "keep-daily", 0, "Keep the newest remote file of each of the last N days")
+	cmd.PersistentFlags().IntVar(&keepWeekly, "keep-weekly", 0, "Keep the newest remote file of each of the last N weeks")
+	cmd.PersistentFlags().IntVar(&keepMonthly, "keep-monthly", 0, "Keep the newest remote file of each of the last N months")
+	cmd.PersistentFlags().StringVar(&keepRegex, "keep-regex", "", "Remote files the retention rules apply to (default: --regex)")
+	cmd.PersistentFlags().IntVar(&localKeepLast, "local-keep-last", 0, "With --delete, keep the newest N local files of each series, in addition to those within --local-keep-within")
+	cmd.PersistentFlags().StringVar(&localKeepWithin, "local-keep-within", "", "With --delete, keep local files younger than this age, e.g. 7d")
+	cmd.PersistentFlags().StringVar(&manifest, "manifest", "", "Record the hash of every uploaded file in a manifest: sidecar (file.sha256 per file) or dir (SHA256SUMS per directory), named after --hash")
+	cmd.PersistentFlags().StringVar(&hashAlgorithm, "hash", checksum.Default, "Hash used to verify copies: "+strings.Join(checksum.Names(), ", "))
+	cmd.PersistentFlags().StringVar(&verifyMode, "verify", VerifyFull, "How uploads are verified (full: reread the whole copy, sample: size and --verify-samples random blocks, none)")
+	cmd.PersistentFlags().IntVar(&verifySamples, "verify-samples", DefaultVerifySamples, "Blocks compared per file with --verify sample")
+	cmd.PersistentFlags().StringVar(&bundle, "bundle", "", "Upload all selected files as zip archives streamed to the share: one per run, day (of modification) or dir (source directory)")
+	cmd.PersistentFlags().BoolVarP(&zippy, "zip", "z", false, "Compress files before copying (same as --compress zip)")
+	cmd.PersistentFlags().StringVar(&compress, "compress", "", "Compress each file before copying: zip, tar.gz, tar.zst or xz")
+	cmd.PersistentFlags().IntVar(&compressLevel, "compress-level", 0, "Compression level (0 = format default; 1-9, or 1-22 for tar.zst)")
+	cmd.PersistentFlags().IntVar(&compressThreads, "compress-threads", 0, "Threads used by tar.zst compression (0 = all CPUs)")
 	cmd.PersistentFlags().StringVarP(&logPath, "log", "l", "smbsync.log", "Path to the log file")
 	cmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Set the log level (debug, info, warn, error)")
 }
@@ -58,6 +58,250 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "local target does not require SMB settings",
+			config: &Config{
+				TargetDir: "/mnt/backups",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid compare mode",
+			config: &Config{
+				TargetDir:   "/mnt/backups",
+				CompareMode: "crc",
+			},
+			wantErr: true,
+		},
+		{
+			name: "offline dry run without destination",
+			config: &Config{
+				DryRun:  true,
+				Offline: true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "offline without dry run",
+			config: &Config{
+				TargetDir: "/mnt/backups",
+				Offline:   true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "bandwidth limit with schedule",
+			config: &Config{
+				TargetDir:  "/mnt/backups",
+				BWLimit:    "10M",
+				BWSchedule: "Mon-Fri 08:00-18:00",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid bandwidth limit",
+			config: &Config{
+				TargetDir: "/mnt/backups",
+				BWLimit:   "fast",
+			},
+			wantErr: true,
+		},
+		{
+			name: "schedule without bandwidth limit",
+			config: &Config{
+				TargetDir:  "/mnt/backups",
+				BWSchedule: "Mon-Fri 08:00-18:00",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid conflict policy",
+			config: &Config{
+				TargetDir:  "/mnt/backups",
+				OnConflict: "replace",
+			},
+			wantErr: true,
+		},
+		{
+			name: "retention rules",
+			config: &Config{
+				TargetDir:  "/mnt/backups",
+				KeepLast:   7,
+				KeepWithin: "30d",
+				KeepWeekly: 4,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid retention age",
+			config: &Config{
+				TargetDir:  "/mnt/backups",
+				KeepWithin: "a month",
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative retention count",
+			config: &Config{
+				TargetDir: "/mnt/backups",
+				KeepLast:  -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "local retention with delete",
+			config: &Config{
+				TargetDir:       "/mnt/backups",
+				DeleteAfter:     true,
+				LocalKeepLast:   3,
+				LocalKeepWithin: "7d",
+			},
+			wantErr: false,
+		},
+		{
+			name: "local retention without delete",
+			config: &Config{
+				TargetDir:     "/mnt/backups",
+				LocalKeepLast: 3,
+			},
+			wantErr: true,
+		},
+		{
+			name: "directory manifest",
+			config: &Config{
+				TargetDir: "/mnt/backups",
+				Manifest:  ManifestDir,
+			},
+			wantErr: false,
+		},
+		{
+			name: "hash algorithm",
+			config: &Config{
+				TargetDir: "/mnt/backups",
+				Hash:      "BLAKE3",
+			},
+			wantErr: false,
+		},
+		{
+			name: "sample verification",
+			config: &Config{
+				TargetDir:     "/mnt/backups",
+				VerifyMode:    VerifySample,
+				VerifySamples: 4,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid verify mode",
+			config: &Config{
+				TargetDir:  "/mnt/backups",
+				VerifyMode: "quick",
+			},
+			wantErr: true,
+		},
+		{
+			name: "bundle per day",
+			config: &Config{
+				TargetDir: "/mnt/backups",
+				Bundle:    BundleDay,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid bundle grouping",
+			config: &Config{
+				TargetDir: "/mnt/backups",
+				Bundle:    "week",
+			},
+			wantErr: true,
+		},
+		{
+			name: "bundle with zip",
+			config: &Config{
+				TargetDir: "/mnt/backups",
+				Bundle:    BundleRun,
+				Zippy:     true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "zstd compression",
+			config: &Config{
+				TargetDir:       "/mnt/backups",
+				Compress:        CompressTarZst,
+				CompressLevel:   19,
+				CompressThreads: 4,
+			},
+			wantErr: false,
+		},
+		{
+			name: "zip with its own level",
+			config: &Config{
+				TargetDir:     "/mnt/backups",
+				Zippy:         true,
+				CompressLevel: 9,
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown compression format",
+			config: &Config{
+				TargetDir: "/mnt/backups",
+				Compress:  "rar",
+			},
+			wantErr: true,
+		},
+		{
+			name: "zip with another format",
+			config: &Config{
+				TargetDir: "/mnt/backups",
+				Zippy:     true,
+				Compress:  CompressXz,
+			},
+			wantErr: true,
+		},
+		{
+			name: "compression level out of range",
+			config: &Config{
+				TargetDir:     "/mnt/backups",
+				Compress:      CompressTarGz,
+				CompressLevel: 12,
+			},
+			wantErr: true,
+		},
+		{
+			name: "compression level without compression",
+			config: &Config{
+				TargetDir:     "/mnt/backups",
+				CompressLevel: 5,
+			},
+			wantErr: true,
+		},
+		{
+			name: "threads for a single threaded format",
+			config: &Config{
+				TargetDir:       "/mnt/backups",
+				Compress:        CompressXz,
+				CompressThreads: 2,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown hash algorithm",
+			config: &Config{
+				TargetDir: "/mnt/backups",
+				Hash:      "md5",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid manifest layout",
+			config: &Config{
+				TargetDir: "/mnt/backups",
+				Manifest:  "sha256",
+			},
+			wantErr: true,
+		},
 		{
 			name: "invalid encryption key length",
 			config: &Config{
@@ -81,6 +325,28 @@ func TestConfig_Validate(t *testing.T) {
 	}
 }
 
+func TestConfig_ValidatePush(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{"no verification", &Config{VerifyMode: VerifyNone}, false},
+		{"no verification with delete", &Config{VerifyMode: VerifyNone, DeleteAfter: true}, true},
+		{"no verification with local retention", &Config{VerifyMode: VerifyNone, DeleteAfter: true, LocalKeepLast: 3}, true},
+		{"sample verification with delete", &Config{VerifyMode: VerifySample, DeleteAfter: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.ValidatePush()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.ValidatePush() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestConfig_EncryptPassword(t *testing.T) {
 	config := &Config{SMBPass: "testpassword"}
 	
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// DefaultEnvFile is read by Load when --env-file is not given. It is optional.
+const DefaultEnvFile = ".env"
+
+// Sources a setting can come from, from lowest to highest precedence.
+const (
+	SourceDefault = "default"
+	SourceEnvFile = ".env"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// envFlags maps environment variables to the flag they set. ENCRYPTION_KEY
+// and the TELEGRAM_* variables are read directly by their packages.
+var envFlags = map[string]string{
+	"SMB_HOST":           "host",
+	"SMB_USER":           "user",
+	"SMB_PASS":           "pass",
+	"SMB_ENCRYPTED_PASS": "encrypted-pass",
+	"SMB_SHARED":         "shared",
+	"SMB_LOCAL_PATH":     "path",
+	"SMB_SHARED_PATH":    "sharedPath",
+	"SMB_REGEX":          "regex",
+	"SMB_TARGET_DIR":     "target-dir",
+	"LOG_PATH":           "log",
+	"LOG_LEVEL":          "log-level",
+}
+
+// secretSettings are masked when the configuration is printed.
+var secretSettings = map[string]bool{
+	"pass":           true,
+	"encrypted-pass": true,
+	"encryption-key": true,
+}
+
+// flagSet holds the flags registered by InitFlags. Without it Load uses the
+// flag variables as they are.
+var flagSet *pflag.FlagSet
+
+// resolveLayers applies the .env file and the environment to every flag that
+// was not set on the command line, and returns where each flag's value came
+// from.
+func resolveLayers() (map[string]string, error) {
+	sources := map[string]string{}
+	if flagSet == nil {
+		return sources, nil
+	}
+
+	fromFile, err := loadEnvFile(envFile, flagSet.Changed("env-file"))
+	if err != nil {
+		return nil, err
+	}
+
+	flagSet.VisitAll(func(f *pflag.Flag) {
+		sources[f.Name] = SourceDefault
+		if f.Changed {
+			sources[f.Name] = SourceFlag
+		}
+	})
+
+	names := make([]string, 0, len(envFlags))
+	for name := range envFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		flagName := envFlags[name]
+		f := flagSet.Lookup(flagName)
+		if f == nil || f.Changed {
+			continue
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := f.Value.Set(value); err != nil {
+			return nil, fmt.Errorf("valor inválido en %s: %w", name, err)
+		}
+		sources[flagName] = SourceEnv
+		if fromFile[name] {
+			sources[flagName] = SourceEnvFile
+		}
+	}
+	return sources, nil
+}
+
+// loadEnvFile exports the variables of a .env file that are not already set
+// in the environment, so the real environment always wins. It returns the
+// names it exported. A missing file is only an error when required.
+func loadEnvFile(path string, required bool) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo leer el archivo %s: %w", path, err)
+	}
+	defer f.Close()
+
+	exported := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+
+		key, value, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: se esperaba CLAVE=valor", path, line)
+		}
+		value = parseEnvValue(strings.TrimSpace(value))
+
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		exported[key] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("no se pudo leer el archivo %s: %w", path, err)
+	}
+	return exported, nil
+}
+
+// parseEnvValue strips matching quotes, or a trailing " # comment" from an
+// unquoted value. Backslashes are kept as written so regexes survive.
+func parseEnvValue(value string) string {
+	if len(value) >= 2 {
+		if q := value[0]; (q == '"' || q == '\'') && value[len(value)-1] == q {
+			return value[1 : len(value)-1]
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+// Setting is one resolved configuration value and where it came from.
+type Setting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// Settings lists the effective configuration by flag name, with secrets
+// masked.
+func (c *Config) Settings() []Setting {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	var settings []Setting
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("yaml")
+		if name == "" {
+			continue
+		}
+		value := fmt.Sprint(v.Field(i).Interface())
+		if secretSettings[name] && value != "" {
+			value = "********"
+		}
+		source := c.sources[name]
+		if source == "" {
+			source = SourceDefault
+		}
+		settings = append(settings, Setting{Name: name, Value: value, Source: source})
+	}
+	return settings
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// unsetEnv clears variables for the duration of the test, restoring them
+// afterwards.
+func unsetEnv(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+// loadWithArgs registers the flags on a fresh command, parses args and loads
+// the configuration.
+func loadWithArgs(t *testing.T, args ...string) *Config {
+	t.Helper()
+	cmd := &cobra.Command{Use: "test"}
+	InitFlags(cmd)
+	t.Cleanup(func() { flagSet = nil })
+
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatalf("ParseFlags failed: %v", err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return cfg
+}
+
+func TestLoad_Layers(t *testing.T) {
+	unsetEnv(t, "SMB_HOST", "SMB_USER", "SMB_PASS", "SMB_SHARED", "SMB_REGEX", "SMB_LOCAL_PATH", "LOG_LEVEL")
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	content := `# SMB Configuration
+SMB_HOST=filehost
+SMB_USER=fileuser
+SMB_PASS="p@ss # not a comment"
+SMB_SHARED=fileshare
+export SMB_REGEX=.*\.bak
+LOG_LEVEL=debug # inline comment
+`
+	if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write .env: %v", err)
+	}
+	t.Setenv("SMB_USER", "envuser")
+	t.Setenv("SMB_LOCAL_PATH", "/var/backups")
+
+	cfg := loadWithArgs(t, "--env-file", envFile, "--shared", "flagshare")
+
+	tests := []struct {
+		name, got, want, source string
+	}{
+		{"host", cfg.SMBHost, "filehost", SourceEnvFile},
+		{"user", cfg.SMBUser, "envuser", SourceEnv},
+		{"pass", cfg.SMBPass, "p@ss # not a comment", SourceEnvFile},
+		{"shared", cfg.Shared, "flagshare", SourceFlag},
+		{"regex", cfg.Regex, `.*\.bak`, SourceEnvFile},
+		{"path", cfg.Path, "/var/backups", SourceEnv},
+		{"log-level", cfg.LogLevel, "debug", SourceEnvFile},
+		{"sharedPath", cfg.SharedPath, ".", SourceDefault},
+	}
+
+	sources := map[string]string{}
+	for _, s := range cfg.Settings() {
+		sources[s.Name] = s.Source
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("Expected %s %q, got %q", tt.name, tt.want, tt.got)
+		}
+		if sources[tt.name] != tt.source {
+			t.Errorf("Expected %s to come from %s, got %s", tt.name, tt.source, sources[tt.name])
+		}
+	}
+}
+
+func TestLoad_MissingEnvFile(t *testing.T) {
+	unsetEnv(t, "SMB_HOST")
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	// The default .env is optional.
+	cfg := loadWithArgs(t)
+	if cfg.SMBHost != "" {
+		t.Errorf("Expected empty host, got %q", cfg.SMBHost)
+	}
+
+	cmd := &cobra.Command{Use: "test"}
+	InitFlags(cmd)
+	if err := cmd.ParseFlags([]string{"--env-file", filepath.Join(dir, "missing.env")}); err != nil {
+		t.Fatalf("ParseFlags failed: %v", err)
+	}
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for a missing --env-file")
+	}
+}
+
+func TestLoad_FlagOverridesEnv(t *testing.T) {
+	cmd := &cobra.Command{Use: "test"}
+	InitFlags(cmd)
+	t.Cleanup(func() { flagSet = nil })
+	t.Chdir(t.TempDir())
+
+	t.Setenv("LOG_LEVEL", "debug")
+	cmd.ParseFlags([]string{"--log-level", "warn"})
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.LogLevel != "warn" {
+		t.Errorf("Expected the flag to win over the environment, got %q", cfg.LogLevel)
+	}
+}
+
+func TestSettings_MasksSecrets(t *testing.T) {
+	cfg := &Config{SMBUser: "user", SMBPass: "secret", EncryptionKey: "1234567890123456"}
+
+	values := map[string]string{}
+	for _, s := range cfg.Settings() {
+		values[s.Name] = s.Value
+	}
+	if values["user"] != "user" {
+		t.Errorf("Expected user to be shown, got %q", values["user"])
+	}
+	for _, name := range []string{"pass", "encryption-key"} {
+		if values[name] != "********" {
+			t.Errorf("Expected %s to be masked, got %q", name, values[name])
+		}
+	}
+	if values["encrypted-pass"] != "" {
+		t.Errorf("Expected empty secrets to stay empty, got %q", values["encrypted-pass"])
+	}
+}
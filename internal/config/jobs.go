@@ -0,0 +1,205 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Commands a job can run.
+const (
+	JobPush   = "push"
+	JobPull   = "pull"
+	JobVerify = "verify"
+)
+
+// Job is a named entry of a jobs file. Schedule is the cron expression used by
+// the daemon; it is empty for jobs that only run on demand.
+type Job struct {
+	Name     string
+	Command  string
+	Schedule string
+	Config   *Config
+}
+
+// JobsFile is a parsed jobs file. Defaults holds the settings shared by every
+// job, on top of the command line flags.
+type JobsFile struct {
+	Defaults *Config
+	Jobs     []Job
+}
+
+// Job returns the job with the given name.
+func (f *JobsFile) Job(name string) (Job, bool) {
+	for _, job := range f.Jobs {
+		if job.Name == name {
+			return job, true
+		}
+	}
+	return Job{}, false
+}
+
+type jobsDocument struct {
+	Defaults yaml.Node `yaml:"defaults"`
+	Jobs     yaml.Node `yaml:"jobs"`
+}
+
+type jobSpec struct {
+	Command  string `yaml:"command"`
+	Schedule string `yaml:"schedule"`
+	Config   `yaml:",inline"`
+}
+
+// LoadJobs reads a YAML jobs file such as:
+//
+//	defaults:
+//	  host: fileserver
+//	  user: backup
+//	  encrypted-pass: ${SMB_ENCRYPTED_PASS}
+//	  shared: backups
+//	jobs:
+//	  sql:
+//	    schedule: "0 2 * * *"
+//	    path: /var/backups/sql
+//	    regex: '\.bak$'
+//	    delete: true
+//	  exports:
+//	    command: pull
+//	    sharedPath: exports
+//	    path: ./entrantes
+//
+// Keys are the command line flag names. Every job starts from base, then the
+// defaults section, then its own settings; flags given explicitly on the
+// command line override both. ${VAR} in any value is replaced with the
+// environment variable VAR. Jobs keep the order of the file.
+func LoadJobs(path string, base *Config) (*JobsFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo leer el archivo de trabajos: %w", err)
+	}
+
+	var doc jobsDocument
+	dec := yaml.NewDecoder(strings.NewReader(string(data)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("archivo de trabajos %s inválido: %w", path, err)
+	}
+
+	defaults := *base
+	if !doc.Defaults.IsZero() {
+		if err := prepareNode(&doc.Defaults, "defaults", false); err != nil {
+			return nil, err
+		}
+		if err := doc.Defaults.Decode(&defaults); err != nil {
+			return nil, fmt.Errorf("defaults: %w", err)
+		}
+		keepFlags(&defaults, base)
+	}
+
+	if doc.Jobs.Kind != yaml.MappingNode || len(doc.Jobs.Content) == 0 {
+		return nil, fmt.Errorf("el archivo de trabajos %s no define ningún trabajo", path)
+	}
+
+	file := &JobsFile{Defaults: &defaults}
+	for i := 0; i < len(doc.Jobs.Content); i += 2 {
+		name, node := doc.Jobs.Content[i].Value, doc.Jobs.Content[i+1]
+		if _, dup := file.Job(name); dup {
+			return nil, fmt.Errorf("trabajo %s duplicado", name)
+		}
+		if err := prepareNode(node, "trabajo "+name, true); err != nil {
+			return nil, err
+		}
+
+		spec := jobSpec{Command: JobPush, Config: defaults}
+		if err := node.Decode(&spec); err != nil {
+			return nil, fmt.Errorf("trabajo %s: %w", name, err)
+		}
+		if spec.Command != JobPush && spec.Command != JobPull && spec.Command != JobVerify {
+			return nil, fmt.Errorf("trabajo %s: command debe ser %q, %q o %q", name, JobPush, JobPull, JobVerify)
+		}
+
+		cfg := spec.Config
+		keepFlags(&cfg, base)
+		file.Jobs = append(file.Jobs, Job{Name: name, Command: spec.Command, Schedule: spec.Schedule, Config: &cfg})
+	}
+	return file, nil
+}
+
+// keepFlags copies into cfg the settings of base that were given on the
+// command line, so they win over the values of the jobs file.
+func keepFlags(cfg, base *Config) {
+	dst, src := reflect.ValueOf(cfg).Elem(), reflect.ValueOf(base).Elem()
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("yaml")
+		if name != "" && base.sources[name] == SourceFlag {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
+
+// prepareNode checks that node is a mapping of known settings and expands
+// environment variables in its values. jobKeys also allows the keys that only
+// make sense in a job, such as command and schedule.
+func prepareNode(node *yaml.Node, where string, jobKeys bool) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s (línea %d): se esperaba un mapa de opciones", where, node.Line)
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if !knownKey(key) && !(jobKeys && (key == "command" || key == "schedule")) {
+			return fmt.Errorf("%s (línea %d): opción desconocida %q", where, node.Content[i].Line, key)
+		}
+	}
+	return expandEnv(node, where)
+}
+
+func knownKey(key string) bool {
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("yaml") == key {
+			return true
+		}
+	}
+	return false
+}
+
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${VAR} in every scalar below node. Undefined variables
+// are an error rather than an empty value, so a missing secret is noticed.
+func expandEnv(node *yaml.Node, where string) error {
+	if node.Kind == yaml.ScalarNode {
+		var missing []string
+		expanded := envRef.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			name := envRef.FindStringSubmatch(ref)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return value
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("%s (línea %d): variable de entorno no definida: %s", where, node.Line, strings.Join(missing, ", "))
+		}
+		if expanded != node.Value {
+			node.Value = expanded
+			// Let an unquoted value such as ${DELETE} resolve to a bool or
+			// number once expanded.
+			if node.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) == 0 {
+				node.Tag = ""
+			}
+		}
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := expandEnv(child, where); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeJobsFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "smbsync.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write jobs file: %v", err)
+	}
+	return path
+}
+
+func TestLoadJobs(t *testing.T) {
+	t.Setenv("SMBSYNC_TEST_PASS", "s3cret")
+	t.Setenv("SMBSYNC_TEST_DELETE", "true")
+
+	path := writeJobsFile(t, `
+defaults:
+  host: fileserver
+  user: backup
+  pass: ${SMBSYNC_TEST_PASS}
+  shared: backups
+  retry-delay: 5s
+jobs:
+  sql:
+    schedule: "0 2 * * *"
+    path: /var/backups/sql
+    regex: '\.bak$'
+    delete: ${SMBSYNC_TEST_DELETE}
+    zip: true
+  exports:
+    command: pull
+    host: other
+    sharedPath: exports
+`)
+
+	base := &Config{Concurrency: 2, LogPath: "smbsync.log"}
+	file, err := LoadJobs(path, base)
+	if err != nil {
+		t.Fatalf("LoadJobs failed: %v", err)
+	}
+
+	if len(file.Jobs) != 2 || file.Jobs[0].Name != "sql" || file.Jobs[1].Name != "exports" {
+		t.Fatalf("Expected jobs sql and exports in file order, got %+v", file.Jobs)
+	}
+
+	sql := file.Jobs[0]
+	if sql.Command != JobPush {
+		t.Errorf("Expected push by default, got %s", sql.Command)
+	}
+	if sql.Schedule != "0 2 * * *" || file.Jobs[1].Schedule != "" {
+		t.Errorf("Unexpected schedules: %q %q", sql.Schedule, file.Jobs[1].Schedule)
+	}
+	cfg := sql.Config
+	if cfg.SMBHost != "fileserver" || cfg.SMBPass != "s3cret" || cfg.Regex != `\.bak$` {
+		t.Errorf("Unexpected sql settings: %+v", cfg)
+	}
+	if !cfg.DeleteAfter || !cfg.Zippy {
+		t.Error("Expected delete and zip to be enabled")
+	}
+	if cfg.Concurrency != 2 || cfg.LogPath != "smbsync.log" {
+		t.Error("Expected settings missing from the file to come from the base config")
+	}
+	if cfg.RetryDelay != 5*time.Second {
+		t.Errorf("Expected retry-delay 5s, got %s", cfg.RetryDelay)
+	}
+
+	exports, ok := file.Job("exports")
+	if !ok {
+		t.Fatal("Expected to find job exports")
+	}
+	if exports.Command != JobPull || exports.Config.SMBHost != "other" || exports.Config.DeleteAfter {
+		t.Errorf("Unexpected exports job: %s %+v", exports.Command, exports.Config)
+	}
+	if file.Defaults.SMBHost != "fileserver" || file.Defaults.Path != "" {
+		t.Errorf("Unexpected defaults: %+v", file.Defaults)
+	}
+	if base.SMBHost != "" {
+		t.Error("Expected the base config to be left untouched")
+	}
+}
+
+func TestLoadJobs_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"no jobs", "defaults:\n  host: a\n", "ningún trabajo"},
+		{"unknown option", "jobs:\n  a:\n    hots: x\n", "hots"},
+		{"unknown section", "job:\n  a:\n    host: x\n", "job"},
+		{"missing variable", "jobs:\n  a:\n    pass: ${SMBSYNC_TEST_UNDEFINED}\n", "SMBSYNC_TEST_UNDEFINED"},
+		{"bad command", "jobs:\n  a:\n    command: sync\n", "command"},
+		{"schedule in defaults", "defaults:\n  schedule: '@daily'\njobs:\n  a:\n    host: x\n", "schedule"},
+		{"bad type", "jobs:\n  a:\n    concurrency: many\n", "trabajo a"},
+		{"duplicate job", "jobs:\n  a:\n    host: x\n  a:\n    host: y\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadJobs(writeJobsFile(t, tt.content), &Config{})
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadJobs_MissingFile(t *testing.T) {
+	if _, err := LoadJobs(filepath.Join(t.TempDir(), "missing.yaml"), &Config{}); err == nil {
+		t.Error("Expected error for a missing file")
+	}
+}
@@ -0,0 +1,241 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported output formats.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatHTML = "html"
+)
+
+// Outcome is what happened to a file during a run.
+type Outcome string
+
+const (
+	Copied  Outcome = "copied"
+	Skipped Outcome = "skipped"
+	Failed  Outcome = "failed"
+	// Deleted means the file was transferred or found up to date and the
+	// original was then removed.
+	Deleted Outcome = "deleted"
+)
+
+// Entry describes one file of a run.
+type Entry struct {
+	File        string  `json:"file"`
+	Destination string  `json:"destination,omitempty"`
+	Outcome     Outcome `json:"outcome"`
+	Bytes       int64   `json:"bytes"`
+	Duration    float64 `json:"duration_seconds"`
+	Throughput  float64 `json:"throughput_bytes_per_second"`
+	SourceHash  string  `json:"source_hash,omitempty"`
+	DestHash    string  `json:"destination_hash,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// Totals aggregates the entries of a report.
+type Totals struct {
+	Files   int   `json:"files"`
+	Copied  int   `json:"copied"`
+	Skipped int   `json:"skipped"`
+	Failed  int   `json:"failed"`
+	Deleted int   `json:"deleted"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// Report collects the result of every file of a run. Add may be called from
+// several goroutines.
+type Report struct {
+	Command       string    `json:"command"`
+	HashAlgorithm string    `json:"hash_algorithm,omitempty"`
+	VerifyMode    string    `json:"verify_mode,omitempty"`
+	Started       time.Time `json:"started"`
+	Finished      time.Time `json:"finished"`
+	Totals        Totals    `json:"totals"`
+	Files         []Entry   `json:"files"`
+
+	mu sync.Mutex
+}
+
+// New starts a report for the given command (push, pull...).
+func New(command string) *Report {
+	return &Report{Command: command, Started: time.Now(), Files: []Entry{}}
+}
+
+// Add records a file. The throughput is derived from Bytes and Duration.
+func (r *Report) Add(e Entry) {
+	if e.Duration > 0 {
+		e.Throughput = float64(e.Bytes) / e.Duration
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Files = append(r.Files, e)
+}
+
+// MarkDeleted records that the local original of file was deleted after its
+// entry was added, as local retention does at the end of a run.
+func (r *Report) MarkDeleted(file string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.Files {
+		if r.Files[i].File == file && r.Files[i].Outcome != Failed {
+			r.Files[i].Outcome = Deleted
+		}
+	}
+}
+
+// Finish stamps the end time, sorts the entries and computes the totals.
+func (r *Report) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Finished = time.Now()
+	sort.Slice(r.Files, func(i, j int) bool { return r.Files[i].File < r.Files[j].File })
+
+	r.Totals = Totals{Files: len(r.Files)}
+	for _, e := range r.Files {
+		r.Totals.Bytes += e.Bytes
+		switch e.Outcome {
+		case Copied:
+			r.Totals.Copied++
+		case Skipped:
+			r.Totals.Skipped++
+		case Failed:
+			r.Totals.Failed++
+		case Deleted:
+			r.Totals.Deleted++
+		}
+	}
+}
+
+// FormatFromPath infers the format from the extension of path, defaulting to
+// JSON.
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV
+	case ".html", ".htm":
+		return FormatHTML
+	}
+	return FormatJSON
+}
+
+// ValidFormat reports whether format is supported. The empty string means
+// "infer from the file name".
+func ValidFormat(format string) bool {
+	switch format {
+	case "", FormatJSON, FormatCSV, FormatHTML:
+		return true
+	}
+	return false
+}
+
+// WriteFile writes the report to path, inferring the format from its
+// extension when format is empty.
+func (r *Report) WriteFile(path, format string) error {
+	if format == "" {
+		format = FormatFromPath(path)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create report %s: %w", path, err)
+	}
+	if err := r.Write(f, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write encodes the report in the given format.
+func (r *Report) Write(w io.Writer, format string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case FormatCSV:
+		return r.writeCSV(w)
+	case FormatHTML:
+		return htmlReport.Execute(w, r)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+func (r *Report) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"file", "destination", "outcome", "bytes", "duration_seconds", "throughput_bytes_per_second", "source_hash", "destination_hash", "hash_algorithm", "verify_mode", "error"})
+	for _, e := range r.Files {
+		cw.Write([]string{
+			e.File,
+			e.Destination,
+			string(e.Outcome),
+			strconv.FormatInt(e.Bytes, 10),
+			strconv.FormatFloat(e.Duration, 'f', 3, 64),
+			strconv.FormatFloat(e.Throughput, 'f', 0, 64),
+			e.SourceHash,
+			e.DestHash,
+			r.HashAlgorithm,
+			r.VerifyMode,
+			e.Error,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"mb":   func(n int64) string { return fmt.Sprintf("%.2f MB", float64(n)/(1024*1024)) },
+	"rate": func(n float64) string { return fmt.Sprintf("%.2f MB/s", n/(1024*1024)) },
+	"secs": func(d float64) string { return fmt.Sprintf("%.2f s", d) },
+	"when": func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+}).Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<title>SMBSync - {{.Command}} {{when .Started}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; font-size: 0.9em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f0f0f0; }
+td.num { text-align: right; }
+code { font-size: 0.85em; word-break: break-all; }
+.copied { color: #1a7f37; }
+.deleted { color: #0550ae; }
+.skipped { color: #6e7781; }
+.failed { color: #cf222e; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>SMBSync: {{.Command}}</h1>
+<p>Inicio: {{when .Started}} &middot; Fin: {{when .Finished}}{{if .HashAlgorithm}} &middot; Hash: {{.HashAlgorithm}}{{end}}{{if .VerifyMode}} &middot; Verificación: {{.VerifyMode}}{{end}}</p>
+<p>{{.Totals.Files}} archivos: {{.Totals.Copied}} copiados, {{.Totals.Deleted}} eliminados, {{.Totals.Skipped}} omitidos, {{.Totals.Failed}} fallidos ({{mb .Totals.Bytes}})</p>
+<table>
+<tr><th>Archivo</th><th>Destino</th><th>Resultado</th><th>Tamaño</th><th>Duración</th><th>Velocidad</th><th>Hash origen</th><th>Hash destino</th><th>Error</th></tr>
+{{range .Files}}<tr>
+<td>{{.File}}</td><td>{{.Destination}}</td><td class="{{.Outcome}}">{{.Outcome}}</td>
+<td class="num">{{mb .Bytes}}</td><td class="num">{{secs .Duration}}</td><td class="num">{{rate .Throughput}}</td>
+<td><code>{{.SourceHash}}</code></td><td><code>{{.DestHash}}</code></td><td>{{.Error}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,143 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sampleReport() *Report {
+	r := New("push")
+	r.Add(Entry{File: "b.bak", Outcome: Copied, Bytes: 2048, Duration: 2, SourceHash: "aa", DestHash: "aa"})
+	r.Add(Entry{File: "a.bak", Outcome: Failed, Error: "hash mismatch"})
+	r.Add(Entry{File: "c.bak", Outcome: Deleted, Bytes: 100, Duration: 1})
+	r.Add(Entry{File: "d.bak", Outcome: Skipped})
+	r.Finish()
+	return r
+}
+
+func TestReport_Totals(t *testing.T) {
+	r := sampleReport()
+
+	want := Totals{Files: 4, Copied: 1, Skipped: 1, Failed: 1, Deleted: 1, Bytes: 2148}
+	if r.Totals != want {
+		t.Errorf("Expected totals %+v, got %+v", want, r.Totals)
+	}
+	if r.Files[0].File != "a.bak" {
+		t.Errorf("Expected entries sorted by file, got %s first", r.Files[0].File)
+	}
+	if r.Files[1].Throughput != 1024 {
+		t.Errorf("Expected throughput 1024, got %f", r.Files[1].Throughput)
+	}
+}
+
+func TestReport_MarkDeleted(t *testing.T) {
+	r := New("push")
+	r.Add(Entry{File: "a.bak", Outcome: Copied})
+	r.Add(Entry{File: "b.bak", Outcome: Skipped})
+	r.Add(Entry{File: "c.bak", Outcome: Failed})
+	r.MarkDeleted("a.bak")
+	r.MarkDeleted("b.bak")
+	r.MarkDeleted("c.bak")
+	r.Finish()
+
+	want := Totals{Files: 3, Failed: 1, Deleted: 2}
+	if r.Totals != want {
+		t.Errorf("Expected totals %+v, got %+v", want, r.Totals)
+	}
+}
+
+func TestReport_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sampleReport().Write(&buf, FormatJSON); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	var decoded Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if decoded.Command != "push" || len(decoded.Files) != 4 {
+		t.Errorf("Expected push report with 4 files, got %s with %d", decoded.Command, len(decoded.Files))
+	}
+	if decoded.Files[0].Error != "hash mismatch" {
+		t.Errorf("Expected error to be kept, got %q", decoded.Files[0].Error)
+	}
+}
+
+func TestReport_CSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sampleReport().Write(&buf, FormatCSV); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV: %v", err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("Expected header and 4 rows, got %d records", len(records))
+	}
+	if records[0][0] != "file" || records[2][2] != "copied" {
+		t.Errorf("Unexpected CSV content: %v", records)
+	}
+}
+
+func TestReport_HTMLEscapes(t *testing.T) {
+	r := New("push")
+	r.Add(Entry{File: "<script>.bak", Outcome: Copied})
+	r.Finish()
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf, FormatHTML); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "<!DOCTYPE html>") {
+		t.Error("Expected a standalone HTML document")
+	}
+	if strings.Contains(out, "<script>.bak") {
+		t.Error("Expected file names to be escaped")
+	}
+}
+
+func TestReport_WriteFileInfersFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+	}{
+		{"run.json", "{"},
+		{"run.csv", "file,"},
+		{"run.html", "<!DOCTYPE html>"},
+		{"run.txt", "{"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.name)
+			if err := sampleReport().WriteFile(path, ""); err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+			if !strings.HasPrefix(string(data), tt.prefix) {
+				t.Errorf("Expected %s to start with %q, got %q", tt.name, tt.prefix, string(data[:20]))
+			}
+		})
+	}
+}
+
+func TestReport_UnknownFormat(t *testing.T) {
+	if err := sampleReport().Write(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+	if ValidFormat("xml") {
+		t.Error("Expected xml to be rejected")
+	}
+}
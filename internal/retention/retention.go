@@ -0,0 +1,161 @@
+// Package retention decides which backups to keep and which to prune.
+package retention
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File is a backup considered by a policy.
+type File struct {
+	// Name is the path of the file, relative to the directory being pruned,
+	// with forward slashes.
+	Name    string
+	ModTime time.Time
+}
+
+// Policy says which files of a series to keep. A file is kept when any rule
+// keeps it, and the newest file of a series is always kept. The zero Policy
+// keeps everything.
+type Policy struct {
+	// Last keeps the newest Last files.
+	Last int
+	// Within keeps files modified less than Within ago.
+	Within time.Duration
+	// Daily, Weekly and Monthly keep the newest file of each of that many
+	// most recent days, ISO weeks and months that have a file.
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+// Enabled reports whether the policy prunes anything.
+func (p Policy) Enabled() bool {
+	return p.Last > 0 || p.Within > 0 || p.Daily > 0 || p.Weekly > 0 || p.Monthly > 0
+}
+
+// Validate rejects negative counts and ages.
+func (p Policy) Validate() error {
+	if p.Last < 0 || p.Within < 0 || p.Daily < 0 || p.Weekly < 0 || p.Monthly < 0 {
+		return fmt.Errorf("retention rules cannot be negative")
+	}
+	return nil
+}
+
+// Plan splits files into those to keep and those to prune. Files are grouped
+// into series first and the policy applies to each series separately; both
+// results are sorted by name.
+func (p Policy) Plan(files []File, now time.Time) (keep, prune []File) {
+	if !p.Enabled() {
+		return sortByName(append([]File(nil), files...)), nil
+	}
+
+	series := map[string][]File{}
+	for _, f := range files {
+		key := Series(f.Name)
+		series[key] = append(series[key], f)
+	}
+	for _, group := range series {
+		k, r := p.planSeries(group, now)
+		keep = append(keep, k...)
+		prune = append(prune, r...)
+	}
+	return sortByName(keep), sortByName(prune)
+}
+
+func (p Policy) planSeries(files []File, now time.Time) (keep, prune []File) {
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].ModTime.Equal(files[j].ModTime) {
+			return files[i].ModTime.After(files[j].ModTime)
+		}
+		return files[i].Name > files[j].Name
+	})
+
+	kept := make([]bool, len(files))
+	kept[0] = true
+	for i, f := range files {
+		if i < p.Last || (p.Within > 0 && now.Sub(f.ModTime) < p.Within) {
+			kept[i] = true
+		}
+	}
+	keepPeriods(files, kept, p.Daily, func(t time.Time) string { return t.Format(time.DateOnly) })
+	keepPeriods(files, kept, p.Weekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	})
+	keepPeriods(files, kept, p.Monthly, func(t time.Time) string { return t.Format("2006-01") })
+
+	for i, f := range files {
+		if kept[i] {
+			keep = append(keep, f)
+		} else {
+			prune = append(prune, f)
+		}
+	}
+	return keep, prune
+}
+
+// keepPeriods marks the newest file of each of the n most recent periods.
+// files must be sorted newest first.
+func keepPeriods(files []File, kept []bool, n int, period func(time.Time) string) {
+	seen := map[string]bool{}
+	for i, f := range files {
+		if len(seen) == n {
+			return
+		}
+		key := period(f.ModTime.Local())
+		if !seen[key] {
+			seen[key] = true
+			kept[i] = true
+		}
+	}
+}
+
+func sortByName(files []File) []File {
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
+
+// stamp matches the dates and timestamps that tell successive backups apart:
+// runs of 6 or more digits (20240131, 1706659200), optionally followed by a
+// time (20240131-220000), and dates written with dashes (2024-01-31), with an
+// optional time (2024-01-31_2200, 2024-01-31T22:00:00).
+var stamp = regexp.MustCompile(`[0-9]{6,}(?:[-_T]?[0-9]{4,6})?|[0-9]{4}-[0-9]{2}-[0-9]{2}(?:[-_T ]?[0-9]{2}(?:[-:.]?[0-9]{2}){0,2})?`)
+
+// Series returns the series a backup belongs to: its directory and its name
+// with every date or timestamp replaced, so that db_20240101.bak and
+// db_20240102.bak are successive backups of the same series. Shorter numbers
+// are part of the name, so host01_20240101.bak and host02_20240101.bak
+// belong to different series.
+func Series(name string) string {
+	dir, base := path.Split(name)
+	return dir + stamp.ReplaceAllString(base, "#")
+}
+
+// ParseAge parses an age such as 30d, 2w, 12h or 90m. Days and weeks are 24
+// and 168 hours; anything else is read by time.ParseDuration.
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.ParseFloat(n, 64)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(v * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,168 @@
+package retention
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2024, 6, 30, 12, 0, 0, 0, time.Local)
+
+// daily returns one backup per day for the last n days, newest first.
+func daily(name string, n int) []File {
+	var files []File
+	for i := 0; i < n; i++ {
+		t := now.AddDate(0, 0, -i)
+		files = append(files, File{Name: name + "_" + t.Format("20060102") + ".bak", ModTime: t})
+	}
+	return files
+}
+
+func names(files []File) []string {
+	var out []string
+	for _, f := range files {
+		out = append(out, f.Name)
+	}
+	return out
+}
+
+func TestPlan_KeepLast(t *testing.T) {
+	keep, prune := Policy{Last: 2}.Plan(daily("db", 4), now)
+
+	if want := []string{"db_20240629.bak", "db_20240630.bak"}; !reflect.DeepEqual(names(keep), want) {
+		t.Errorf("Expected to keep %v, got %v", want, names(keep))
+	}
+	if want := []string{"db_20240627.bak", "db_20240628.bak"}; !reflect.DeepEqual(names(prune), want) {
+		t.Errorf("Expected to prune %v, got %v", want, names(prune))
+	}
+}
+
+func TestPlan_KeepWithin(t *testing.T) {
+	keep, prune := Policy{Within: 72 * time.Hour}.Plan(daily("db", 5), now)
+
+	if len(keep) != 3 || len(prune) != 2 {
+		t.Errorf("Expected 3 kept and 2 pruned, got %v and %v", names(keep), names(prune))
+	}
+}
+
+func TestPlan_AlwaysKeepsNewest(t *testing.T) {
+	keep, prune := Policy{Within: time.Hour}.Plan(daily("db", 3)[1:], now)
+
+	if want := []string{"db_20240629.bak"}; !reflect.DeepEqual(names(keep), want) {
+		t.Errorf("Expected the newest file to be kept, got %v", names(keep))
+	}
+	if len(prune) != 1 {
+		t.Errorf("Expected 1 file pruned, got %v", names(prune))
+	}
+}
+
+func TestPlan_PerSeries(t *testing.T) {
+	files := append(daily("sales", 3), daily("hr", 3)...)
+	files = append(files, File{Name: "archive/sales_20240101.bak", ModTime: now.AddDate(0, -6, 0)})
+
+	keep, prune := Policy{Last: 1}.Plan(files, now)
+
+	want := []string{"archive/sales_20240101.bak", "hr_20240630.bak", "sales_20240630.bak"}
+	if !reflect.DeepEqual(names(keep), want) {
+		t.Errorf("Expected to keep %v, got %v", want, names(keep))
+	}
+	if len(prune) != 4 {
+		t.Errorf("Expected 4 files pruned, got %v", names(prune))
+	}
+}
+
+func TestPlan_GFS(t *testing.T) {
+	// Two backups a day for 120 days.
+	var files []File
+	for i := 0; i < 120; i++ {
+		day := now.AddDate(0, 0, -i)
+		for _, t := range []time.Time{day, day.Add(-6 * time.Hour)} {
+			files = append(files, File{Name: "db_" + t.Format("20060102T1504") + ".bak", ModTime: t})
+		}
+	}
+
+	keep, _ := Policy{Daily: 7, Weekly: 4, Monthly: 3}.Plan(files, now)
+
+	kept := map[string]bool{}
+	for _, f := range keep {
+		kept[f.Name] = true
+	}
+	for i := 0; i < 7; i++ {
+		day := now.AddDate(0, 0, -i).Format("20060102") + "T1200"
+		if !kept["db_"+day+".bak"] {
+			t.Errorf("Expected the last backup of day %s to be kept", day)
+		}
+	}
+	for _, month := range []string{"20240531T1200", "20240430T1200"} {
+		if !kept["db_"+month+".bak"] {
+			t.Errorf("Expected the last backup of the month %s to be kept", month)
+		}
+	}
+	if kept["db_20240630T0600.bak"] {
+		t.Error("Expected only the newest backup of a day to be kept")
+	}
+	// 7 days, plus the weeks and months not already covered by them.
+	if len(keep) < 7 || len(keep) > 7+4+3 {
+		t.Errorf("Unexpected number of kept files: %d", len(keep))
+	}
+}
+
+func TestPlan_Disabled(t *testing.T) {
+	keep, prune := Policy{}.Plan(daily("db", 3), now)
+	if len(keep) != 3 || len(prune) != 0 {
+		t.Errorf("Expected a disabled policy to keep everything, got %v and %v", names(keep), names(prune))
+	}
+}
+
+func TestSeries(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"db_20240101.bak", "db_20240102.bak", true},
+		{"db_2024-01-01_0200.zip", "db_2024-02-11_0300.zip", true},
+		{"db_20240101-220000.zip", "db_20240102-230000.zip", true},
+		{"db_2024-01-01T02:00:00.bak", "db_2024-01-02T03:30:00.bak", true},
+		{"db_1706659200.bak", "db_1706745600.bak", true},
+		{"host01_20240101.bak", "host02_20240101.bak", false},
+		{"db1_2024-01-01.bak", "db2_2024-01-01.bak", false},
+		{"sales_1.bak", "hr_1.bak", false},
+		{"a/db_1.bak", "b/db_1.bak", false},
+		{"db_1.bak", "db_1.zip", false},
+	}
+
+	for _, tt := range tests {
+		if got := Series(tt.a) == Series(tt.b); got != tt.same {
+			t.Errorf("Expected same series for %s and %s to be %v", tt.a, tt.b, tt.same)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"30d", 30 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"1.5d", 36 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"-1d", 0, true},
+		{"d", 0, true},
+		{"soon", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAge(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAge(%q): expected error %v, got %v", tt.input, tt.wantErr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAge(%q): expected %s, got %s", tt.input, tt.want, got)
+		}
+	}
+}
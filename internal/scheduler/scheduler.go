@@ -0,0 +1,230 @@
+// Package scheduler runs jobs of a jobs file on cron schedules and keeps the
+// status of their last run.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+	"github.com/robfig/cron/v3"
+)
+
+// Results of a run.
+const (
+	ResultOK     = "ok"
+	ResultFailed = "failed"
+)
+
+// Runner runs one job. Once ctx is done it should stop starting new files
+// and return after finishing the ones in progress.
+type Runner func(ctx context.Context, job config.Job) error
+
+// Status is the state of a scheduled job.
+type Status struct {
+	Name      string     `json:"name"`
+	Command   string     `json:"command"`
+	Schedule  string     `json:"schedule"`
+	Running   bool       `json:"running"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+	LastStart *time.Time `json:"last_start,omitempty"`
+	LastEnd   *time.Time `json:"last_end,omitempty"`
+	// LastResult is ResultOK or ResultFailed, or empty if the job never ran.
+	LastResult string `json:"last_result,omitempty"`
+	LastError  string `json:"last_error,omitempty"`
+	Runs       int    `json:"runs"`
+	Failures   int    `json:"failures"`
+	// Overlaps counts the runs skipped because the previous one was still
+	// running.
+	Overlaps int `json:"overlaps"`
+}
+
+type entry struct {
+	job      config.Job
+	schedule cron.Schedule
+	id       cron.EntryID
+	status   Status
+}
+
+// Scheduler runs each job on its schedule. A job never overlaps with itself:
+// a run that comes due while the previous one is still going is skipped.
+type Scheduler struct {
+	run        Runner
+	statusPath string
+	cron       *cron.Cron
+
+	mu      sync.Mutex
+	entries []*entry
+	// saveMu keeps concurrent saves from replacing a newer status file with
+	// an older one.
+	saveMu sync.Mutex
+}
+
+// New parses the schedule of every job. Schedules use the standard five cron
+// fields (minute, hour, day of month, month, day of week) or a descriptor such
+// as @daily or @every 30m, in local time unless prefixed with CRON_TZ=. The
+// status is written as JSON to statusPath after every change, unless it is
+// empty.
+func New(jobs []config.Job, run Runner, statusPath string) (*Scheduler, error) {
+	if len(jobs) == 0 {
+		return nil, errors.New("no hay trabajos con schedule")
+	}
+
+	s := &Scheduler{
+		run:        run,
+		statusPath: statusPath,
+		cron:       cron.New(cron.WithChain(cron.Recover(cron.DefaultLogger))),
+	}
+	for _, job := range jobs {
+		schedule, err := cron.ParseStandard(job.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("trabajo %s: schedule %q inválido: %w", job.Name, job.Schedule, err)
+		}
+		s.entries = append(s.entries, &entry{
+			job:      job,
+			schedule: schedule,
+			status:   Status{Name: job.Name, Command: job.Command, Schedule: job.Schedule},
+		})
+	}
+	return s, nil
+}
+
+// Run starts the schedules and blocks until ctx is done. It then stops
+// scheduling, waits for the jobs in progress, which see ctx canceled, and
+// returns.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	for _, e := range s.entries {
+		e.id = s.cron.Schedule(e.schedule, cron.FuncJob(func() { s.runJob(ctx, e) }))
+	}
+	s.mu.Unlock()
+	s.cron.Start()
+	s.save()
+
+	for _, e := range s.entries {
+		logger.Sugar.Infof("Trabajo %s programado (%s), próxima ejecución: %s", e.job.Name, e.job.Schedule, s.nextRun(e).Format(time.DateTime))
+	}
+
+	<-ctx.Done()
+	logger.Sugar.Info("Deteniendo el planificador, esperando a los trabajos en curso")
+	<-s.cron.Stop().Done()
+	s.save()
+	return nil
+}
+
+// runJob runs e unless it is already running.
+func (s *Scheduler) runJob(ctx context.Context, e *entry) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	s.mu.Lock()
+	if e.status.Running {
+		e.status.Overlaps++
+		s.mu.Unlock()
+		logger.Sugar.Warnf("El trabajo %s sigue en ejecución, se omite esta ejecución", e.job.Name)
+		s.save()
+		return
+	}
+	start := time.Now()
+	e.status.Running = true
+	e.status.LastStart = &start
+	s.mu.Unlock()
+	s.save()
+
+	logger.Sugar.Infof("Ejecutando trabajo %s (%s)", e.job.Name, e.job.Command)
+	err := s.run(ctx, e.job)
+
+	s.mu.Lock()
+	end := time.Now()
+	e.status.Running = false
+	e.status.LastEnd = &end
+	e.status.Runs++
+	e.status.LastResult, e.status.LastError = ResultOK, ""
+	if err != nil {
+		e.status.Failures++
+		e.status.LastResult, e.status.LastError = ResultFailed, err.Error()
+	}
+	s.mu.Unlock()
+	s.save()
+
+	if err != nil {
+		logger.Sugar.Errorf("El trabajo %s terminó con errores: %v", e.job.Name, err)
+		return
+	}
+	logger.Sugar.Infof("Trabajo %s completado en %s", e.job.Name, end.Sub(start).Round(time.Second))
+}
+
+func (s *Scheduler) nextRun(e *entry) time.Time {
+	if e.id != 0 {
+		if next := s.cron.Entry(e.id).Next; !next.IsZero() {
+			return next
+		}
+	}
+	return e.schedule.Next(time.Now())
+}
+
+// Status returns the status of every job, in the order of the jobs file.
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(s.entries))
+	for _, e := range s.entries {
+		status := e.status
+		next := s.nextRun(e)
+		status.NextRun = &next
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// ServeHTTP writes the status of every job as JSON.
+func (s *Scheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(s.Status())
+}
+
+// save writes the status file atomically.
+func (s *Scheduler) save() {
+	if s.statusPath == "" {
+		return
+	}
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	if err := writeStatus(s.statusPath, s.Status()); err != nil {
+		logger.Sugar.Warnf("No se pudo escribir el estado del planificador: %v", err)
+	}
+}
+
+func writeStatus(path string, statuses []Status) error {
+	data, err := json.MarshalIndent(statuses, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,189 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+	"go.uber.org/zap"
+)
+
+func init() {
+	logger.Sugar = zap.NewNop().Sugar()
+}
+
+func testJob(name, schedule string) config.Job {
+	return config.Job{Name: name, Command: config.JobPush, Schedule: schedule, Config: &config.Config{}}
+}
+
+func noop(ctx context.Context, job config.Job) error { return nil }
+
+func TestNew_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		jobs []config.Job
+		want string
+	}{
+		{"no jobs", nil, "schedule"},
+		{"empty schedule", []config.Job{testJob("sql", "")}, "trabajo sql"},
+		{"bad schedule", []config.Job{testJob("sql", "0 25 * * *")}, "trabajo sql"},
+		{"too many fields", []config.Job{testJob("sql", "0 0 2 * * *")}, "trabajo sql"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.jobs, noop, "")
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestNew_Schedules(t *testing.T) {
+	for _, schedule := range []string{"0 2 * * *", "*/15 8-18 * * Mon-Fri", "@daily", "@every 30m", "CRON_TZ=UTC 0 3 * * *"} {
+		if _, err := New([]config.Job{testJob("a", schedule)}, noop, ""); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", schedule, err)
+		}
+	}
+}
+
+func TestRunJob_RecordsStatus(t *testing.T) {
+	statusPath := filepath.Join(t.TempDir(), "status.json")
+	fail := errors.New("share unreachable")
+	results := []error{nil, fail}
+	var calls int
+	s, err := New([]config.Job{testJob("sql", "@daily")}, func(ctx context.Context, job config.Job) error {
+		calls++
+		return results[calls-1]
+	}, statusPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.runJob(context.Background(), s.entries[0])
+	status := s.Status()[0]
+	if status.Runs != 1 || status.Failures != 0 || status.LastResult != ResultOK || status.Running {
+		t.Errorf("Unexpected status after a successful run: %+v", status)
+	}
+
+	s.runJob(context.Background(), s.entries[0])
+	status = s.Status()[0]
+	if status.Runs != 2 || status.Failures != 1 || status.LastResult != ResultFailed || status.LastError != fail.Error() {
+		t.Errorf("Unexpected status after a failed run: %+v", status)
+	}
+	if status.LastStart == nil || status.LastEnd == nil || status.NextRun == nil || !status.NextRun.After(time.Now()) {
+		t.Errorf("Expected start, end and next run times, got %+v", status)
+	}
+
+	data, err := os.ReadFile(statusPath)
+	if err != nil {
+		t.Fatalf("Expected status file: %v", err)
+	}
+	var saved []Status
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("Invalid status file: %v", err)
+	}
+	if len(saved) != 1 || saved[0].Name != "sql" || saved[0].Failures != 1 {
+		t.Errorf("Unexpected status file: %s", data)
+	}
+}
+
+func TestRunJob_SkipsOverlappingRuns(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int32
+	s, err := New([]config.Job{testJob("sql", "@every 1m")}, func(ctx context.Context, job config.Job) error {
+		calls.Add(1)
+		close(started)
+		<-release
+		return nil
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.runJob(context.Background(), s.entries[0])
+		close(done)
+	}()
+	<-started
+
+	if !s.Status()[0].Running {
+		t.Error("Expected the job to be reported as running")
+	}
+	s.runJob(context.Background(), s.entries[0])
+	close(release)
+	<-done
+
+	status := s.Status()[0]
+	if calls.Load() != 1 || status.Runs != 1 || status.Overlaps != 1 {
+		t.Errorf("Expected one run and one skipped overlap, got %d calls and %+v", calls.Load(), status)
+	}
+}
+
+func TestRun_WaitsForJobOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var finished atomic.Bool
+	s, err := New([]config.Job{testJob("sql", "@every 1s")}, func(jobCtx context.Context, job config.Job) error {
+		cancel()
+		<-jobCtx.Done()
+		time.Sleep(50 * time.Millisecond)
+		finished.Store(true)
+		return nil
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if !finished.Load() {
+		t.Error("Expected Run to wait for the job in progress")
+	}
+	if status := s.Status()[0]; status.Runs != 1 || status.Running {
+		t.Errorf("Unexpected status after shutdown: %+v", status)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	s, err := New([]config.Job{testJob("sql", "@daily"), testJob("logs", "@hourly")}, noop, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", ct)
+	}
+	var statuses []Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].Name != "sql" || statuses[1].Schedule != "@hourly" {
+		t.Errorf("Unexpected statuses: %+v", statuses)
+	}
+}
@@ -0,0 +1,422 @@
+package smb
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+)
+
+// bundlePrefix names the archives that do not take the name of a directory.
+const bundlePrefix = "smbsync"
+
+// bundle is one archive of a --bundle run and the local files it holds.
+type bundle struct {
+	// remotePath is the planned name of the archive; the upload may pick a
+	// free name next to it if it already exists.
+	remotePath string
+	entries    []bundleEntry
+	size       int64
+}
+
+// bundleEntry is a local file and its name inside the archive.
+type bundleEntry struct {
+	file string
+	name string
+	info os.FileInfo
+}
+
+// archivedEntry is what was written to the archive for one entry, as computed
+// from the local file while it was streamed.
+type archivedEntry struct {
+	crc  uint32
+	size int64
+}
+
+// planBundles groups files into the archives of cfg.Bundle. Files that cannot
+// be read are returned in failed instead.
+func planBundles(cfg *config.Config, files []string, now time.Time) (bundles []*bundle, failed map[string]error) {
+	failed = map[string]error{}
+	stamp := now.Format("20060102-150405")
+	byPath := map[string]*bundle{}
+
+	for _, file := range files {
+		localPath := filepath.Join(cfg.Path, file)
+		info, err := os.Stat(localPath)
+		if err != nil {
+			logger.Sugar.Errorf("Error al obtener información del archivo local %s: %v", localPath, err)
+			failed[file] = fmt.Errorf("could not stat local file %s: %w", localPath, err)
+			continue
+		}
+
+		entry := bundleEntry{file: file, name: filepath.ToSlash(file), info: info}
+		var remotePath string
+		switch cfg.Bundle {
+		case config.BundleDay:
+			day := info.ModTime().Format(time.DateOnly)
+			remotePath = filepath.Join(cfg.SharedPath, bundlePrefix+"-"+day+".zip")
+		case config.BundleDir:
+			// The archive takes the place of the directory on the share.
+			dir := filepath.Dir(file)
+			entry.name = filepath.Base(file)
+			if dir == "." {
+				remotePath = filepath.Join(cfg.SharedPath, bundlePrefix+"-"+stamp+".zip")
+			} else {
+				remotePath = filepath.Join(cfg.SharedPath, dir+"-"+stamp+".zip")
+			}
+		default:
+			remotePath = filepath.Join(cfg.SharedPath, bundlePrefix+"-"+stamp+".zip")
+		}
+
+		b := byPath[remotePath]
+		if b == nil {
+			b = &bundle{remotePath: remotePath}
+			byPath[remotePath] = b
+			bundles = append(bundles, b)
+		}
+		b.entries = append(b.entries, entry)
+		b.size += info.Size()
+	}
+
+	sort.Slice(bundles, func(i, k int) bool { return bundles[i].remotePath < bundles[k].remotePath })
+	return bundles, failed
+}
+
+// syncBundles uploads files as the archives of cfg.Bundle, using up to
+// cfg.Concurrency workers, one archive each. The local files of an archive are
+// only deleted once the archive lists every one of them with the size and
+// CRC-32 read from the local disk.
+func syncBundles(ctx context.Context, fs RemoteFS, cfg *config.Config, files []string) error {
+	job := newSyncJob(ctx, fs, cfg, "push")
+	bundles, failedFiles := planBundles(cfg, files, time.Now())
+	for file, err := range failedFiles {
+		job.record(file, &transfer{}, outcomeFailed, err, 0)
+	}
+
+	names := make([]string, len(bundles))
+	byName := map[string]*bundle{}
+	var total int64
+	for i, b := range bundles {
+		names[i] = b.remotePath
+		byName[b.remotePath] = b
+		total += b.size
+	}
+	logger.Sugar.Infof("%d archivos agrupados en %d paquetes", len(files)-len(failedFiles), len(bundles))
+
+	workers := workerCount(cfg.Concurrency, len(bundles))
+	if workers > 1 {
+		logger.Sugar.Infof("Empaquetando con %d transferencias en paralelo", workers)
+		job.progress = newProgressBar(total, fmt.Sprintf("Empaquetando (%d en paralelo)...", workers))
+	}
+
+	failed, notStarted := runPool(ctx, workers, names, func(name string) error {
+		return job.copyBundle(byName[name])
+	})
+	job.flushManifests()
+
+	if job.progress != nil {
+		job.progress.Finish()
+	}
+	notDeleted := job.pruneLocal(files)
+	logger.Sugar.Info("Proceso de sincronización completado.")
+	if notStarted > 0 {
+		logger.Sugar.Warnf("Sincronización interrumpida: %d paquetes sin procesar", notStarted)
+	}
+	logger.Sugar.Infof("Resumen: %d archivos copiados, %d paquetes fallidos, %d archivos ilegibles", job.copied, failed, len(failedFiles))
+	job.writeReport()
+	return bundleResult(failed, notStarted, len(bundles), len(failedFiles), notDeleted, len(files))
+}
+
+// bundleResult is runResult for a bundled run, which counts archives and
+// files separately: failed and notStarted of the archives, and the files that
+// could not be read or whose local copy could not be deleted.
+func bundleResult(failed, notStarted, archives, unreadable, notDeleted, files int) error {
+	var errs []error
+	if failed > 0 {
+		errs = append(errs, fmt.Errorf("%w: %d of %d archives failed", ErrIncomplete, failed, archives))
+	}
+	if unreadable > 0 {
+		errs = append(errs, fmt.Errorf("%w: %d of %d files could not be read", ErrIncomplete, unreadable, files))
+	}
+	if notDeleted > 0 {
+		errs = append(errs, fmt.Errorf("%w: %d of %d local files could not be deleted", ErrIncomplete, notDeleted, files))
+	}
+	if notStarted > 0 {
+		errs = append(errs, fmt.Errorf("%w: %d of %d archives not started", ErrInterrupted, notStarted, archives))
+	}
+	return errors.Join(errs...)
+}
+
+// copyBundle uploads and checks one archive, retrying transient failures,
+// then deletes its local files as configured and records them.
+func (j *syncJob) copyBundle(b *bundle) error {
+	start := time.Now()
+	var (
+		target   string
+		archived map[string]archivedEntry
+	)
+	err := j.withRetry(b.remotePath, func() error {
+		var err error
+		target, archived, err = uploadBundle(j, b)
+		return err
+	})
+	elapsed := time.Since(start)
+	if err != nil {
+		logger.Sugar.Errorf("Fallo al copiar el paquete %s: %v", b.remotePath, err)
+		for _, e := range b.entries {
+			j.record(e.file, &transfer{destination: b.remotePath}, outcomeFailed, err, elapsed)
+		}
+		return err
+	}
+
+	var failed error
+	for _, e := range b.entries {
+		t := &transfer{destination: target, bytes: archived[e.name].size}
+		var err error
+		if j.cfg.DeleteAfter && changedSince(filepath.Join(j.cfg.Path, e.file), e.info, archived[e.name].size) {
+			logger.Sugar.Warnf("Se conserva el archivo local %s: cambió mientras se empaquetaba", e.file)
+		} else {
+			t.deleted, err = deleteLocal(j, e.file)
+		}
+		j.record(e.file, t, outcomeCopied, err, elapsed)
+		if err != nil {
+			failed = err
+		}
+	}
+
+	j.mu.Lock()
+	j.copied += len(b.entries)
+	j.mu.Unlock()
+	if failed != nil {
+		return failed
+	}
+	logger.Sugar.Infof("Paquete %s copiado y verificado exitosamente (%d archivos).", target, len(b.entries))
+	return nil
+}
+
+// changedSince reports whether localPath no longer is the file of info that
+// was archived with size bytes, so deleting it would lose data.
+func changedSince(localPath string, info os.FileInfo, size int64) bool {
+	now, err := os.Stat(localPath)
+	if err != nil {
+		return true
+	}
+	return now.Size() != size || !now.ModTime().Equal(info.ModTime())
+}
+
+// uploadBundle streams the archive of b straight into a temporary remote
+// file, checks its central directory against the entries that were written
+// and moves it to its final name, which it returns.
+func uploadBundle(job *syncJob, b *bundle) (string, map[string]archivedEntry, error) {
+	fs := job.fs
+	target := b.remotePath
+	if _, err := fs.Stat(target); err == nil {
+		if target, err = freeRemoteName(fs, b.remotePath, time.Now()); err != nil {
+			return "", nil, err
+		}
+		logger.Sugar.Infof("El paquete %s ya existe, se copiará como %s", b.remotePath, filepath.Base(target))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", nil, fmt.Errorf("could not stat remote file %s: %w", target, err)
+	}
+
+	if err := fs.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		logger.Sugar.Errorf("Error al crear directorio remoto %s: %v", filepath.Dir(target), err)
+		return "", nil, fmt.Errorf("could not create remote directory %s: %w", filepath.Dir(target), err)
+	}
+
+	partFilePath := partPath(target)
+	remoteFile, err := fs.Create(partFilePath)
+	if err != nil {
+		logger.Sugar.Errorf("Error al crear archivo remoto %s: %v", partFilePath, err)
+		return "", nil, fmt.Errorf("could not create remote file %s: %w", partFilePath, err)
+	}
+
+	logger.Sugar.Infof("Empaquetando %d archivos (%.2f MB) en %s", len(b.entries), float64(b.size)/(1024*1024), target)
+	sourceHash := job.hasher.New()
+	bar := job.copyProgress(b.size, 0)
+	zipWriter := newZipWriter(io.MultiWriter(job.limiter.Writer(remoteFile), sourceHash), job.cfg.CompressLevel)
+
+	archived := map[string]archivedEntry{}
+	for _, e := range b.entries {
+		written, err := addBundleEntry(job, zipWriter, e, bar)
+		if err != nil {
+			remoteFile.Close()
+			removePart(job, partFilePath)
+			return "", nil, err
+		}
+		archived[e.name] = written
+	}
+	err = zipWriter.Close()
+	if closeErr := remoteFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removePart(job, partFilePath)
+		return "", nil, fmt.Errorf("could not finish archive %s: %w", partFilePath, err)
+	}
+	sourceHashSum := sourceHash.Sum(nil)
+
+	if err := checkArchive(fs, partFilePath, archived); err != nil {
+		logger.Sugar.Errorf("El paquete %s no coincide con los archivos locales: %v", target, err)
+		removePart(job, partFilePath)
+		return "", nil, err
+	}
+	logger.Sugar.Infof("Contenido del paquete %s verificado: %d entradas leídas con su tamaño y CRC-32", target, len(archived))
+	// Reading the entries back is the check of sample mode; full mode also
+	// compares the hash of the whole archive.
+	if job.cfg.VerifyMode != config.VerifySample {
+		if _, err := verifyIntegrity(job, partFilePath, nil, sourceHashSum, filepath.Base(target)); err != nil {
+			removePart(job, partFilePath)
+			return "", nil, err
+		}
+	}
+
+	logger.Sugar.Debugf("Renombrando %s a %s", partFilePath, target)
+	if err := fs.Rename(partFilePath, target); err != nil {
+		logger.Sugar.Errorf("Error al renombrar archivo remoto %s a %s: %v", partFilePath, target, err)
+		removePart(job, partFilePath)
+		return "", nil, fmt.Errorf("could not rename remote file to %s: %w", target, err)
+	}
+	job.recordManifest(target, sourceHashSum)
+	return target, archived, nil
+}
+
+// addBundleEntry compresses one local file into the archive and returns the
+// CRC-32 and size of what was read from it.
+func addBundleEntry(job *syncJob, zipWriter *zip.Writer, e bundleEntry, bar io.Writer) (archivedEntry, error) {
+	localPath := filepath.Join(job.cfg.Path, e.file)
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		logger.Sugar.Errorf("Error al abrir archivo local %s: %v", localPath, err)
+		return archivedEntry{}, fmt.Errorf("could not open local file %s: %w", localPath, err)
+	}
+	defer localFile.Close()
+
+	header := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: e.info.ModTime()}
+	header.SetMode(e.info.Mode())
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return archivedEntry{}, fmt.Errorf("failed to create zip entry %s: %w", e.name, err)
+	}
+
+	crc := crc32.NewIEEE()
+	n, err := io.Copy(writer, io.TeeReader(localFile, io.MultiWriter(crc, bar)))
+	if err != nil {
+		logger.Sugar.Errorf("Error al empaquetar el archivo %s: %v", e.file, err)
+		return archivedEntry{}, fmt.Errorf("failed to copy %s to the archive: %w", e.file, err)
+	}
+	logger.Sugar.Debugf("Empaquetado %s (%d bytes, CRC-32 %08x)", e.name, n, crc.Sum32())
+	return archivedEntry{crc: crc.Sum32(), size: n}, nil
+}
+
+// checkArchive reads the uploaded archive back and checks that it holds
+// exactly the entries in want, with their size and CRC-32. The index fields
+// were computed locally while writing, so every entry is also read in full
+// and decompressed, which makes archive/zip check its CRC-32 against the
+// data on the share.
+func checkArchive(fs RemoteFS, remotePath string, want map[string]archivedEntry) error {
+	f, err := fs.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("could not reopen remote file for verification: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("could not get remote file info: %w", err)
+	}
+	archive, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		return fmt.Errorf("%w: unreadable archive: %v", errHashMismatch, err)
+	}
+
+	seen := map[string]bool{}
+	for _, zf := range archive.File {
+		entry, ok := want[zf.Name]
+		if !ok || seen[zf.Name] {
+			return fmt.Errorf("%w: unexpected archive entry %s", errHashMismatch, zf.Name)
+		}
+		seen[zf.Name] = true
+		if zf.CRC32 != entry.crc || zf.UncompressedSize64 != uint64(entry.size) {
+			return fmt.Errorf("%w: archive entry %s has size %d and CRC-32 %08x, expected %d and %08x",
+				errHashMismatch, zf.Name, zf.UncompressedSize64, zf.CRC32, entry.size, entry.crc)
+		}
+		if err := readEntry(zf); err != nil {
+			return fmt.Errorf("%w: archive entry %s: %v", errHashMismatch, zf.Name, err)
+		}
+	}
+	if len(seen) != len(want) {
+		return fmt.Errorf("%w: archive has %d of %d entries", errHashMismatch, len(seen), len(want))
+	}
+	return nil
+}
+
+// readEntry decompresses zf to the end, which fails if its data does not
+// match its CRC-32.
+func readEntry(zf *zip.File) error {
+	r, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(io.Discard, r)
+	return err
+}
+
+// dryRunBundles logs the archives a --bundle run would write. fs may be nil
+// to plan without connecting.
+func dryRunBundles(fs RemoteFS, cfg *config.Config, files []string) error {
+	if fs == nil {
+		logger.Sugar.Info("[simulación] Modo sin conexión: no se consulta el destino")
+	} else {
+		logger.Sugar.Info("[simulación] No se escribirá nada en el destino ni se eliminarán archivos locales")
+	}
+
+	localKeep, _ := cfg.LocalRetentionPolicy()
+	bundles, failed := planBundles(cfg, files, time.Now())
+	deletes := 0
+	verified := map[string]bool{}
+	for _, b := range bundles {
+		target := b.remotePath
+		if fs != nil {
+			if _, err := fs.Stat(target); err == nil {
+				logger.Sugar.Infof("[simulación] El paquete %s ya existe, se crearía con otro nombre", target)
+			}
+		}
+		logger.Sugar.Infof("[simulación] %s: se crearía con %d archivos (%.2f MB)", target, len(b.entries), float64(b.size)/(1024*1024))
+		for _, e := range b.entries {
+			logger.Sugar.Infof("[simulación] %s -> %s:%s", e.file, target, e.name)
+			if !cfg.DeleteAfter {
+				continue
+			}
+			if localKeep.Enabled() {
+				verified[e.file] = true
+				continue
+			}
+			deletes++
+			logger.Sugar.Infof("[simulación] %s: se eliminaría el archivo local %s", e.file, filepath.Join(cfg.Path, e.file))
+		}
+	}
+	if localKeep.Enabled() {
+		for _, file := range localPrune(cfg.Path, localKeep, files, verified) {
+			deletes++
+			logger.Sugar.Infof("[simulación] %s: la retención local eliminaría el archivo local %s", file, filepath.Join(cfg.Path, file))
+		}
+	}
+
+	logger.Sugar.Infof("[simulación] Resumen: %d paquetes con %d archivos, %d fallarían, %d archivos locales a eliminar",
+		len(bundles), len(files)-len(failed), len(failed), deletes)
+	if len(failed) > 0 {
+		return fmt.Errorf("%w: %d of %d could not be planned", ErrIncomplete, len(failed), len(files))
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+package smb
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/report"
+)
+
+func TestPlanBundles(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{
+		"a.log":     "a",
+		"web/b.log": "b",
+		"web/c.log": "c",
+	})
+	monday := time.Date(2026, 10, 12, 9, 0, 0, 0, time.Local)
+	for name, mtime := range map[string]time.Time{
+		"a.log":     monday,
+		"web/b.log": monday.Add(30 * time.Minute),
+		"web/c.log": monday.AddDate(0, 0, 1),
+	} {
+		if err := os.Chtimes(filepath.Join(localDir, filepath.FromSlash(name)), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := []string{"a.log", filepath.Join("web", "b.log"), filepath.Join("web", "c.log"), "gone.log"}
+	now := time.Date(2026, 10, 17, 22, 15, 0, 0, time.Local)
+
+	testCases := []struct {
+		grouping string
+		// want maps each archive to the names of its entries.
+		want map[string][]string
+	}{
+		{config.BundleRun, map[string][]string{
+			"logs/smbsync-20261017-221500.zip": {"a.log", "web/b.log", "web/c.log"},
+		}},
+		{config.BundleDay, map[string][]string{
+			"logs/smbsync-2026-10-12.zip": {"a.log", "web/b.log"},
+			"logs/smbsync-2026-10-13.zip": {"web/c.log"},
+		}},
+		{config.BundleDir, map[string][]string{
+			"logs/smbsync-20261017-221500.zip": {"a.log"},
+			"logs/web-20261017-221500.zip":     {"b.log", "c.log"},
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.grouping, func(t *testing.T) {
+			cfg := &config.Config{Path: localDir, SharedPath: "logs", Bundle: tc.grouping}
+			bundles, failed := planBundles(cfg, files, now)
+
+			got := map[string][]string{}
+			for _, b := range bundles {
+				for _, e := range b.entries {
+					got[filepath.ToSlash(b.remotePath)] = append(got[filepath.ToSlash(b.remotePath)], e.name)
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+			if _, ok := failed["gone.log"]; len(failed) != 1 || !ok {
+				t.Errorf("Expected gone.log to fail, got %v", failed)
+			}
+		})
+	}
+}
+
+func readRemoteZip(t *testing.T, fs RemoteFS, name string) map[string]string {
+	t.Helper()
+	data := readRemoteFile(t, fs, name)
+	archive, err := zip.NewReader(bytes.NewReader([]byte(data)), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to open archive %s: %v", name, err)
+	}
+	entries := map[string]string{}
+	for _, zf := range archive.File {
+		r, err := zf.Open()
+		if err != nil {
+			t.Fatalf("Failed to open entry %s: %v", zf.Name, err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("Failed to read entry %s: %v", zf.Name, err)
+		}
+		entries[zf.Name] = string(content)
+	}
+	return entries
+}
+
+func TestSyncBundles(t *testing.T) {
+	for _, mode := range []string{config.VerifyFull, config.VerifySample, config.VerifyNone} {
+		t.Run(mode, func(t *testing.T) {
+			localDir := t.TempDir()
+			files := map[string]string{"app.log": "started", "web/access.log": "GET /", "web/error.log": "500"}
+			writeTestFiles(t, localDir, files)
+			fs := NewMemFS()
+			reportPath := filepath.Join(t.TempDir(), "report.json")
+			// Without verification the originals are never deleted.
+			deletes := mode != config.VerifyNone
+			cfg := &config.Config{
+				Path:        localDir,
+				SharedPath:  "logs",
+				Bundle:      config.BundleRun,
+				DeleteAfter: deletes,
+				VerifyMode:  mode,
+				Report:      reportPath,
+			}
+
+			names := []string{"app.log", filepath.Join("web", "access.log"), filepath.Join("web", "error.log")}
+			if err := syncBundles(context.Background(), fs, cfg, names); err != nil {
+				t.Fatalf("syncBundles failed: %v", err)
+			}
+
+			remote, err := fs.ReadDir("logs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(remote) != 1 {
+				t.Fatalf("Expected a single archive and no temporary file, got %d files", len(remote))
+			}
+			archive := filepath.Join("logs", remote[0].Name())
+			if got := readRemoteZip(t, fs, archive); !reflect.DeepEqual(got, files) {
+				t.Errorf("Expected the archive to hold %v, got %v", files, got)
+			}
+			for _, name := range names {
+				if _, err := os.Stat(filepath.Join(localDir, name)); deletes != os.IsNotExist(err) {
+					t.Errorf("Expected local file %s deleted=%v, got %v", name, deletes, err)
+				}
+			}
+
+			want := report.Deleted
+			if !deletes {
+				want = report.Copied
+			}
+			r := readReport(t, reportPath)
+			if len(r.Files) != 3 || r.Files[0].Destination != archive || r.Files[0].Outcome != want {
+				t.Errorf("Expected one %s entry per file in %s, got %+v", want, archive, r.Files)
+			}
+		})
+	}
+}
+
+func TestSyncBundles_ExistingArchive(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.log": "a"})
+	mtime := time.Date(2026, 10, 12, 9, 0, 0, 0, time.Local)
+	if err := os.Chtimes(filepath.Join(localDir, "a.log"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	fs := NewMemFS()
+	writeRemoteFile(t, fs, "smbsync-2026-10-12.zip", "earlier run")
+
+	cfg := &config.Config{Path: localDir, SharedPath: ".", Bundle: config.BundleDay}
+	if err := syncBundles(context.Background(), fs, cfg, []string{"a.log"}); err != nil {
+		t.Fatalf("syncBundles failed: %v", err)
+	}
+
+	if got := readRemoteFile(t, fs, "smbsync-2026-10-12.zip"); got != "earlier run" {
+		t.Errorf("Expected the existing archive to be kept, got %q", got)
+	}
+	remote, _ := fs.ReadDir(".")
+	if len(remote) != 2 {
+		t.Errorf("Expected the new archive next to the existing one, got %d files", len(remote))
+	}
+}
+
+func TestSyncBundles_CorruptArchiveKeepsLocalFiles(t *testing.T) {
+	for _, mode := range []string{config.VerifyFull, config.VerifySample} {
+		t.Run(mode, func(t *testing.T) {
+			localDir := t.TempDir()
+			writeTestFiles(t, localDir, map[string]string{"a.log": "first", "b.log": "second"})
+			fs := &faultyFS{RemoteFS: NewMemFS(), corrupt: true}
+			cfg := &config.Config{Path: localDir, SharedPath: ".", Bundle: config.BundleRun, DeleteAfter: true, VerifyMode: mode}
+
+			err := syncBundles(context.Background(), fs, cfg, []string{"a.log", "b.log"})
+			if !errors.Is(err, ErrIncomplete) {
+				t.Fatalf("Expected ErrIncomplete, got %v", err)
+			}
+
+			if remote, _ := fs.ReadDir("."); len(remote) != 0 {
+				t.Errorf("Expected nothing left on the share, got %d files", len(remote))
+			}
+			for _, name := range []string{"a.log", "b.log"} {
+				if _, err := os.Stat(filepath.Join(localDir, name)); err != nil {
+					t.Errorf("Local file %s must be kept when the archive does not check: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncBundles_UnreadableFileCountedApart(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.log": "first", "b.log": "second"})
+	fs := NewMemFS()
+	cfg := &config.Config{Path: localDir, SharedPath: ".", Bundle: config.BundleRun}
+
+	err := syncBundles(context.Background(), fs, cfg, []string{"a.log", "b.log", "missing.log"})
+	if !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Expected ErrIncomplete, got %v", err)
+	}
+	if want := "1 of 3 files could not be read"; !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected %q in the error, got %v", want, err)
+	}
+	if strings.Contains(err.Error(), "archives failed") {
+		t.Errorf("Expected the archive to succeed, got %v", err)
+	}
+}
+
+func TestCheckArchive(t *testing.T) {
+	fs := NewMemFS()
+	f, err := fs.Create("logs.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, content := range map[string]string{"a.log": "first", "b.log": "second"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+	zw.Close()
+	f.Close()
+
+	a := archivedEntry{crc: crc32.ChecksumIEEE([]byte("first")), size: 5}
+	b := archivedEntry{crc: crc32.ChecksumIEEE([]byte("second")), size: 6}
+	testCases := []struct {
+		name    string
+		want    map[string]archivedEntry
+		wantErr bool
+	}{
+		{"match", map[string]archivedEntry{"a.log": a, "b.log": b}, false},
+		{"missing entry", map[string]archivedEntry{"a.log": a, "b.log": b, "c.log": b}, true},
+		{"extra entry", map[string]archivedEntry{"a.log": a}, true},
+		{"wrong crc", map[string]archivedEntry{"a.log": a, "b.log": {crc: a.crc, size: 6}}, true},
+		{"wrong size", map[string]archivedEntry{"a.log": a, "b.log": {crc: b.crc, size: 7}}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkArchive(fs, "logs.zip", tc.want)
+			if tc.wantErr && !errors.Is(err, errHashMismatch) {
+				t.Errorf("Expected errHashMismatch, got %v", err)
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckArchive_CorruptData(t *testing.T) {
+	fs := NewMemFS()
+	f, err := fs.Create("logs.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "a.log", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "first")
+	zw.Close()
+	f.Close()
+
+	// The index still lists the right size and CRC-32, only the stored data
+	// differs.
+	data := []byte(readRemoteFile(t, fs, "logs.zip"))
+	i := bytes.Index(data, []byte("first"))
+	data[i] = 'F'
+	writeRemoteFile(t, fs, "logs.zip", string(data))
+
+	want := map[string]archivedEntry{"a.log": {crc: crc32.ChecksumIEEE([]byte("first")), size: 5}}
+	if err := checkArchive(fs, "logs.zip", want); !errors.Is(err, errHashMismatch) {
+		t.Errorf("Expected errHashMismatch, got %v", err)
+	}
+}
+
+func TestDryRunBundles_WritesNothing(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.log": "a", "b.log": "b"})
+	fs := &countingFS{RemoteFS: NewMemFS()}
+	cfg := &config.Config{Path: localDir, SharedPath: ".", Bundle: config.BundleRun, DeleteAfter: true, DryRun: true}
+
+	if err := planRun(fs, cfg, []string{"a.log", "b.log"}); err != nil {
+		t.Fatalf("planRun failed: %v", err)
+	}
+	if fs.written != 0 {
+		t.Errorf("Expected nothing written, got %d bytes", fs.written)
+	}
+	for _, name := range []string{"a.log", "b.log"} {
+		if _, err := os.Stat(filepath.Join(localDir, name)); err != nil {
+			t.Errorf("Local file %s must be kept by a dry run: %v", name, err)
+		}
+	}
+}
@@ -1,13 +1,39 @@
 package smb
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/hirochachacha/go-smb2"
+	"github.com/hvarillas/smbsync/internal/checksum"
 	"github.com/hvarillas/smbsync/internal/config"
 	"github.com/hvarillas/smbsync/internal/logger"
+	"github.com/hvarillas/smbsync/internal/report"
+	"github.com/hvarillas/smbsync/internal/retention"
+	"github.com/hvarillas/smbsync/internal/throttle"
+	"github.com/schollz/progressbar/v3"
+)
+
+var (
+	// ErrConnection is returned by RunHeadless when the SMB session or share
+	// could not be established.
+	ErrConnection = errors.New("smb connection failed")
+	// ErrIncomplete is returned by RunHeadless when at least one file failed.
+	ErrIncomplete = errors.New("some files could not be synchronized")
+	// ErrInterrupted is returned when a run was canceled before every file
+	// was processed.
+	ErrInterrupted = errors.New("sync interrupted")
+	// ErrMismatch is returned by RunVerify when a remote file is missing,
+	// changed or not listed in any manifest.
+	ErrMismatch = errors.New("remote files do not match their manifests")
 )
 
 func getSmbSession(user, password, smbHost string) (*smb2.Session, error) {
@@ -38,34 +64,326 @@ func getSmbSession(user, password, smbHost string) (*smb2.Session, error) {
 	return s, nil
 }
 
-func RunHeadless(cfg *config.Config) {
+// connect opens the sync destination described by cfg: a local directory when
+// TargetDir is set, otherwise the configured SMB share. The returned function
+// releases the connection.
+func connect(cfg *config.Config) (RemoteFS, func(), error) {
+	if cfg.TargetDir != "" {
+		logger.Sugar.Infof("Usando directorio local como destino: %s", cfg.TargetDir)
+		return NewLocalFS(cfg.TargetDir), func() {}, nil
+	}
+
+	session, err := getSmbSession(cfg.SMBUser, cfg.SMBPass, cfg.SMBHost)
+	if err != nil {
+		logger.Sugar.Errorf("No se pudo establecer la sesión SMB: %v", err)
+		return nil, nil, fmt.Errorf("%w: %w", ErrConnection, err)
+	}
+
+	share, err := session.Mount(cfg.Shared)
+	if err != nil {
+		session.Logoff()
+		logger.Sugar.Errorf("No se pudo montar el recurso compartido '%s': %v", cfg.Shared, err)
+		return nil, nil, fmt.Errorf("%w: mount %s: %w", ErrConnection, cfg.Shared, err)
+	}
+
+	release := func() {
+		share.Umount()
+		session.Logoff()
+	}
+	return NewSMBFS(share), release, nil
+}
+
+func RunHeadless(cfg *config.Config) error {
+	return RunHeadlessContext(context.Background(), cfg)
+}
+
+// RunHeadlessContext is RunHeadless for a run that can be stopped. Once ctx is
+// done no further file is started, files already in progress are finished and
+// ErrInterrupted is returned if any file was left out.
+func RunHeadlessContext(ctx context.Context, cfg *config.Config) error {
 	logger.Sugar.Info("Iniciando en modo headless (sin TUI).")
-	files := getRegexFiles(cfg.Regex, cfg.Path)
+	files := selectFiles(cfg)
 	if files == nil || len(files) == 0 {
 		logger.Sugar.Warnf("No se encontraron archivos que coincidan con el patrón en: %s", cfg.Path)
-		return
+		return nil
 	}
 
 	logger.Sugar.Infof("Encontrados %d archivos para sincronizar", len(files))
-	session, err := getSmbSession(cfg.SMBUser, cfg.SMBPass, cfg.SMBHost)
+	if cfg.DryRun && cfg.Offline {
+		err := planRun(nil, cfg, files)
+		if policy, _ := cfg.RetentionPolicy(); policy.Enabled() {
+			logger.Sugar.Warn("[simulación] Retención: no se puede simular sin conectar con el destino")
+		}
+		return err
+	}
+
+	fs, err := openSessionContext(ctx, cfg)
 	if err != nil {
-		logger.Sugar.Fatalf("No se pudo establecer la sesión SMB: %v", err)
+		return err
 	}
-	defer session.Logoff()
+	defer fs.Close()
 
-	share, err := session.Mount(cfg.Shared)
+	if cfg.DryRun {
+		if err := planRun(fs, cfg, files); err != nil {
+			return err
+		}
+		return pruneRemote(fs, cfg, true)
+	}
+	push := syncFiles
+	if cfg.Bundle != "" {
+		push = syncBundles
+	}
+	if err := push(ctx, fs, cfg, files); err != nil {
+		if policy, _ := cfg.RetentionPolicy(); policy.Enabled() {
+			logger.Sugar.Warn("Retención: no se aplica porque la sincronización no terminó correctamente")
+		}
+		return err
+	}
+	return pruneRemote(fs, cfg, false)
+}
+
+// planRun logs what a dry run of files would do, file by file or archive by
+// archive with --bundle.
+func planRun(fs RemoteFS, cfg *config.Config, files []string) error {
+	if cfg.Bundle != "" {
+		return dryRunBundles(fs, cfg, files)
+	}
+	_, err := dryRun(fs, cfg, files)
+	return err
+}
+
+// syncJob carries the state shared by every file of a run. It is used
+// concurrently by the workers of a parallel run.
+type syncJob struct {
+	ctx      context.Context
+	cfg      *config.Config
+	fs       RemoteFS
+	journal  *resumeJournal
+	progress *progressbar.ProgressBar
+	report   *report.Report
+	limiter  *throttle.Limiter
+	hasher   checksum.Hasher
+	// localKeep is the local retention policy; verifiedLocal holds the files
+	// whose copy was verified and that it may delete.
+	localKeep     retention.Policy
+	verifiedLocal map[string]bool
+
+	mu      sync.Mutex
+	copied  int
+	skipped []string
+
+	// manifestMu guards the manifests and pendingManifests, the directory
+	// manifest entries not yet written, by manifest path.
+	manifestMu       sync.Mutex
+	pendingManifests map[string]map[string]manifestEntry
+}
+
+// newSyncJob prepares the shared state of a push or pull run.
+func newSyncJob(ctx context.Context, fs RemoteFS, cfg *config.Config, command string) *syncJob {
+	job := &syncJob{ctx: ctx, cfg: cfg, fs: fs, verifiedLocal: map[string]bool{}}
+	job.localKeep, _ = cfg.LocalRetentionPolicy()
+	job.hasher = jobHasher(cfg)
+	if cfg.Report != "" {
+		job.report = report.New(command)
+		job.report.HashAlgorithm = job.hasher.Name()
+		// Downloads are always verified in full: only the local disk is
+		// reread.
+		job.report.VerifyMode = config.VerifyFull
+		if command != "pull" && cfg.VerifyMode != "" {
+			job.report.VerifyMode = cfg.VerifyMode
+		}
+	}
+	if cfg.BWLimit != "" {
+		job.limiter = newLimiter(cfg)
+	}
+	return job
+}
+
+// jobHasher returns the hash algorithm of cfg, which config.Validate checked.
+func jobHasher(cfg *config.Config) checksum.Hasher {
+	hasher, err := checksum.Get(cfg.Hash)
 	if err != nil {
-		logger.Sugar.Fatalf("No se pudo montar el recurso compartido '%s': %v", cfg.Shared, err)
+		hasher, _ = checksum.Get(checksum.Default)
 	}
-	defer share.Umount()
+	return hasher
+}
 
-	for i, file := range files {
-		logger.Sugar.Infof("Procesando archivo %d de %d: %s", i+1, len(files), file)
-		if err := startCopy(share, file, cfg.Path, cfg.SharedPath, cfg.DeleteAfter, cfg.Zippy); err != nil {
-			logger.Sugar.Errorf("Fallo al copiar %s: %v", file, err)
-		} else {
-			logger.Sugar.Infof("Archivo %s copiado y verificado exitosamente.", file)
+// newLimiter returns the bandwidth limiter shared by all workers of a run, or
+// nil when no limit applies. The settings were checked by config.Validate.
+func newLimiter(cfg *config.Config) *throttle.Limiter {
+	rate, err := throttle.ParseRate(cfg.BWLimit)
+	if err != nil || rate == 0 {
+		return nil
+	}
+	var schedule *throttle.Schedule
+	if cfg.BWSchedule != "" {
+		if schedule, err = throttle.ParseSchedule(cfg.BWSchedule); err != nil {
+			return nil
 		}
+		logger.Sugar.Infof("Límite de ancho de banda: %.2f MB/s en el horario %s", float64(rate)/(1024*1024), cfg.BWSchedule)
+	} else {
+		logger.Sugar.Infof("Límite de ancho de banda: %.2f MB/s", float64(rate)/(1024*1024))
+	}
+	return throttle.New(rate, schedule)
+}
+
+// syncFiles runs the copy, verify and delete pipeline for every file against
+// an already connected destination, using up to cfg.Concurrency workers.
+func syncFiles(ctx context.Context, fs RemoteFS, cfg *config.Config, files []string) error {
+	job := newSyncJob(ctx, fs, cfg, "push")
+	job.journal = openJournal(cfg)
+
+	workers := workerCount(cfg.Concurrency, len(files))
+	if workers > 1 {
+		logger.Sugar.Infof("Copiando con %d transferencias en paralelo", workers)
+		job.progress = newProgressBar(totalSize(cfg.Path, files), fmt.Sprintf("Copiando (%d en paralelo)...", workers))
 	}
+
+	failed, notStarted := runPool(ctx, workers, files, job.copyFile)
+	job.flushManifests()
+
+	if job.progress != nil {
+		job.progress.Finish()
+	}
+	failed += job.pruneLocal(files)
 	logger.Sugar.Info("Proceso de sincronización completado.")
+	if notStarted > 0 {
+		logger.Sugar.Warnf("Sincronización interrumpida: %d archivos sin procesar", notStarted)
+	}
+	logger.Sugar.Infof("Resumen: %d copiados, %d omitidos, %d fallidos", job.copied, len(job.skipped), failed)
+	if len(job.skipped) > 0 {
+		sort.Strings(job.skipped)
+		logger.Sugar.Infof("Archivos omitidos: %s", strings.Join(job.skipped, ", "))
+	}
+	job.writeReport()
+	return runResult(failed, notStarted, len(files))
+}
+
+// runResult turns the counts of a finished pool into the error of the run.
+func runResult(failed, notStarted, total int) error {
+	var errs []error
+	if failed > 0 {
+		errs = append(errs, fmt.Errorf("%w: %d of %d failed", ErrIncomplete, failed, total))
+	}
+	if notStarted > 0 {
+		errs = append(errs, fmt.Errorf("%w: %d of %d not started", ErrInterrupted, notStarted, total))
+	}
+	return errors.Join(errs...)
+}
+
+// openJournal loads the resume journal when cfg.Resume is set.
+func openJournal(cfg *config.Config) *resumeJournal {
+	if !cfg.Resume {
+		return nil
+	}
+	if cfg.CompressFormat() != "" {
+		logger.Sugar.Warn("--resume no se aplica a las copias comprimidas: se comprimen directamente en el destino y se reinician desde el principio")
+		return nil
+	}
+	statePath := cfg.ResumeState
+	if statePath == "" {
+		statePath = config.DefaultResumeState
+	}
+	journal, err := loadResumeJournal(statePath)
+	if err != nil {
+		logger.Sugar.Errorf("No se pudo cargar el diario de reanudación, las copias no serán reanudables: %v", err)
+		return nil
+	}
+	return journal
+}
+
+// copyFile runs the copy, verify and delete pipeline for one file, retrying
+// transient failures, and records the result.
+func (j *syncJob) copyFile(file string) error {
+	start, t := time.Now(), &transfer{}
+	var outcome copyOutcome
+	err := j.withRetry(file, func() error {
+		*t = transfer{}
+		var err error
+		outcome, err = startCopy(j, file, t)
+		return err
+	})
+	j.record(file, t, outcome, err, time.Since(start))
+	if err != nil {
+		logger.Sugar.Errorf("Fallo al copiar %s: %v", file, err)
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if outcome == outcomeSkipped {
+		j.skipped = append(j.skipped, file)
+		return nil
+	}
+	j.copied++
+	if j.cfg.VerifyMode == config.VerifyNone {
+		logger.Sugar.Infof("Archivo %s copiado sin verificar.", file)
+		return nil
+	}
+	logger.Sugar.Infof("Archivo %s copiado y verificado exitosamente.", file)
+	return nil
+}
+
+// workerCount bounds the configured concurrency by the number of files.
+func workerCount(concurrency, files int) int {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > files {
+		concurrency = files
+	}
+	return concurrency
+}
+
+// runPool calls process for every file using the given number of workers and
+// returns how many files failed. Once ctx is done no further file is handed
+// to the workers; those files are counted in notStarted.
+func runPool(ctx context.Context, workers int, files []string, process func(file string) error) (failed, notStarted int) {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	queue := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				logger.Sugar.Infof("Procesando archivo %d de %d: %s", i+1, len(files), files[i])
+				if err := process(files[i]); err != nil {
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+dispatch:
+	for i := range files {
+		if ctx.Err() != nil {
+			notStarted = len(files) - i
+			break
+		}
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			notStarted = len(files) - i
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return failed, notStarted
+}
+
+// totalSize returns the combined size of files under basePath, ignoring files
+// that cannot be read.
+func totalSize(basePath string, files []string) int64 {
+	var total int64
+	for _, file := range files {
+		if info, err := os.Stat(filepath.Join(basePath, file)); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
 }
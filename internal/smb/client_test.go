@@ -1,6 +1,14 @@
 package smb
 
 import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/hvarillas/smbsync/internal/config"
@@ -59,3 +67,336 @@ func TestRunHeadless_InvalidConfig(t *testing.T) {
 	var cfg *config.Config
 	RunHeadless(cfg)
 }
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file %s: %v", name, err)
+		}
+	}
+}
+
+func readRemoteFile(t *testing.T, fs RemoteFS, name string) string {
+	t.Helper()
+	f, err := fs.Open(name)
+	if err != nil {
+		t.Fatalf("Failed to open remote file %s: %v", name, err)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("Failed to read remote file %s: %v", name, err)
+	}
+	return string(content)
+}
+
+func TestSyncFiles_CopyVerifyDelete(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{
+		"db1.bak": "first backup",
+		"db2.bak": "second backup",
+	})
+
+	fs := NewMemFS()
+	cfg := &config.Config{
+		Path:        localDir,
+		SharedPath:  ".",
+		DeleteAfter: true,
+	}
+
+	if err := syncFiles(context.Background(), fs, cfg, []string{"db1.bak", "db2.bak"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+
+	if got := readRemoteFile(t, fs, "db1.bak"); got != "first backup" {
+		t.Errorf("Unexpected remote content for db1.bak: %q", got)
+	}
+	if got := readRemoteFile(t, fs, "db2.bak"); got != "second backup" {
+		t.Errorf("Unexpected remote content for db2.bak: %q", got)
+	}
+	for _, name := range []string{"db1.bak", "db2.bak"} {
+		if _, err := os.Stat(filepath.Join(localDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected local file %s to be deleted", name)
+		}
+	}
+}
+
+func TestSyncFiles_Zip(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"report.csv": "a,b,c\n1,2,3\n"})
+
+	fs := NewMemFS()
+	cfg := &config.Config{Path: localDir, SharedPath: ".", Zippy: true}
+
+	if err := syncFiles(context.Background(), fs, cfg, []string{"report.csv"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+
+	content := readRemoteFile(t, fs, "report.zip")
+	zr, err := zip.NewReader(strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("Remote file is not a valid zip: %v", err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "report.csv" {
+		t.Errorf("Unexpected zip entries: %v", zr.File)
+	}
+	if _, err := os.Stat(filepath.Join(localDir, "report.csv")); err != nil {
+		t.Errorf("Local file should be kept without --delete: %v", err)
+	}
+}
+
+func TestSyncFiles_CreatesRemoteDirectory(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "a"})
+
+	fs := NewMemFS()
+	cfg := &config.Config{Path: localDir, SharedPath: "backups/daily"}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+	if got := readRemoteFile(t, fs, "backups/daily/a.bak"); got != "a" {
+		t.Errorf("Unexpected remote content: %q", got)
+	}
+}
+
+func TestSyncFiles_RemoteFailureKeepsLocalFile(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "a"})
+
+	fs := NewMemFS()
+	blocker, _ := fs.Create("blocked")
+	blocker.Close()
+
+	cfg := &config.Config{Path: localDir, SharedPath: "blocked", DeleteAfter: true}
+	err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"})
+	if !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Expected ErrIncomplete, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(localDir, "a.bak")); err != nil {
+		t.Errorf("Local file must not be deleted when the copy fails: %v", err)
+	}
+}
+
+func TestSyncFiles_RecursiveTree(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{
+		"root.bak":          "root",
+		"2024/jan/db.bak":   "january",
+		"2024/feb/db.bak":   "february",
+		"2024/feb/notes.md": "ignored",
+	})
+
+	fs := NewMemFS()
+	cfg := &config.Config{
+		Regex:      `\.bak$`,
+		Path:       localDir,
+		SharedPath: "archive",
+		Recursive:  true,
+	}
+	files := selectFiles(cfg)
+	if err := syncFiles(context.Background(), fs, cfg, files); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"archive/root.bak":        "root",
+		"archive/2024/jan/db.bak": "january",
+		"archive/2024/feb/db.bak": "february",
+	}
+	for name, content := range expected {
+		if got := readRemoteFile(t, fs, name); got != content {
+			t.Errorf("Expected %q in %s, got %q", content, name, got)
+		}
+	}
+	if _, err := fs.Stat("archive/2024/feb/notes.md"); err == nil {
+		t.Error("Files not matching the regex must not be copied")
+	}
+}
+
+func TestRunHeadless_LocalTarget(t *testing.T) {
+	localDir := t.TempDir()
+	targetDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{
+		"keep.txt":   "ignored",
+		"backup.bak": "payload",
+	})
+
+	cfg := &config.Config{
+		Regex:      `\.bak$`,
+		Path:       localDir,
+		SharedPath: ".",
+		TargetDir:  targetDir,
+	}
+	if err := RunHeadless(cfg); err != nil {
+		t.Fatalf("RunHeadless failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(targetDir, "backup.bak"))
+	if err != nil || string(content) != "payload" {
+		t.Errorf("Expected backup.bak in target dir, got %q (%v)", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "keep.txt")); !os.IsNotExist(err) {
+		t.Error("Files not matching the regex must not be copied")
+	}
+}
+
+// failingFS fails the upload of every file whose name matches fail.
+type failingFS struct {
+	RemoteFS
+	fail func(name string) bool
+}
+
+func (f *failingFS) Create(name string) (RemoteFile, error) {
+	if f.fail(name) {
+		return nil, errors.New("access denied")
+	}
+	return f.RemoteFS.Create(name)
+}
+
+func TestSyncFiles_Parallel(t *testing.T) {
+	localDir := t.TempDir()
+	files := make(map[string]string)
+	var names []string
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("file%02d.bak", i)
+		files[name] = strings.Repeat(name, i+1)
+		names = append(names, name)
+	}
+	writeTestFiles(t, localDir, files)
+
+	fs := NewMemFS()
+	cfg := &config.Config{Path: localDir, SharedPath: ".", Concurrency: 4, DeleteAfter: true}
+	if err := syncFiles(context.Background(), fs, cfg, names); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+
+	for name, content := range files {
+		if got := readRemoteFile(t, fs, name); got != content {
+			t.Errorf("Unexpected content for %s: %q", name, got)
+		}
+		if _, err := os.Stat(filepath.Join(localDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected local file %s to be deleted", name)
+		}
+	}
+}
+
+func TestSyncFiles_ParallelCountsFailures(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{
+		"ok1.bak":  "1",
+		"bad1.bak": "2",
+		"ok2.bak":  "3",
+		"bad2.bak": "4",
+		"ok3.bak":  "5",
+	})
+
+	fs := &failingFS{
+		RemoteFS: NewMemFS(),
+		fail:     func(name string) bool { return strings.Contains(name, "bad") },
+	}
+	cfg := &config.Config{Path: localDir, SharedPath: ".", Concurrency: 3, DeleteAfter: true}
+	err := syncFiles(context.Background(), fs, cfg, []string{"ok1.bak", "bad1.bak", "ok2.bak", "bad2.bak", "ok3.bak"})
+	if !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Expected ErrIncomplete, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "2 of 5 failed") {
+		t.Errorf("Expected 2 of 5 failures to be reported, got %v", err)
+	}
+
+	for _, name := range []string{"bad1.bak", "bad2.bak"} {
+		if _, err := os.Stat(filepath.Join(localDir, name)); err != nil {
+			t.Errorf("Failed file %s must be kept locally: %v", name, err)
+		}
+	}
+	for _, name := range []string{"ok1.bak", "ok2.bak", "ok3.bak"} {
+		if got := readRemoteFile(t, fs, name); got == "" {
+			t.Errorf("Expected %s on the share", name)
+		}
+	}
+}
+
+// cancelingFS cancels the run when the first upload starts.
+type cancelingFS struct {
+	RemoteFS
+	cancel context.CancelFunc
+}
+
+func (f *cancelingFS) Create(name string) (RemoteFile, error) {
+	f.cancel()
+	return f.RemoteFS.Create(name)
+}
+
+func TestSyncFiles_StopsWhenCanceled(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{
+		"a.bak": "first",
+		"b.bak": "second",
+		"c.bak": "third",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs := &cancelingFS{RemoteFS: NewMemFS(), cancel: cancel}
+	cfg := &config.Config{Path: localDir, SharedPath: ".", DeleteAfter: true}
+
+	err := syncFiles(ctx, fs, cfg, []string{"a.bak", "b.bak", "c.bak"})
+	if !errors.Is(err, ErrInterrupted) || errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Expected only ErrInterrupted, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "2 of 3 not started") {
+		t.Errorf("Expected 2 of 3 files not started, got %v", err)
+	}
+
+	if got := readRemoteFile(t, fs, "a.bak"); got != "first" {
+		t.Errorf("Expected the file in progress to be finished, got %q", got)
+	}
+	for _, name := range []string{"b.bak", "c.bak"} {
+		if _, err := fs.Stat(name); err == nil {
+			t.Errorf("Expected %s not to be copied after cancel", name)
+		}
+		if _, err := os.Stat(filepath.Join(localDir, name)); err != nil {
+			t.Errorf("Expected local %s to be kept: %v", name, err)
+		}
+	}
+}
+
+func TestNewSyncJob_BandwidthLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *config.Config
+		limited bool
+	}{
+		{"no limit", &config.Config{}, false},
+		{"zero limit", &config.Config{BWLimit: "0"}, false},
+		{"limit", &config.Config{BWLimit: "10M"}, true},
+		{"scheduled limit", &config.Config{BWLimit: "10M", BWSchedule: "Mon-Fri 08:00-18:00"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newSyncJob(context.Background(), NewMemFS(), tt.cfg, "push")
+			if got := job.limiter != nil; got != tt.limited {
+				t.Errorf("Expected limited=%v, got %v", tt.limited, got)
+			}
+		})
+	}
+}
+
+func TestSyncFiles_BandwidthLimit(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "alpha", "b.bak": "beta"})
+
+	fs := NewMemFS()
+	cfg := &config.Config{Path: localDir, SharedPath: ".", Concurrency: 2, BWLimit: "1M"}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"a.bak", "b.bak"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+	if got := readRemoteFile(t, fs, "b.bak"); got != "beta" {
+		t.Errorf("Expected remote content beta, got %q", got)
+	}
+}
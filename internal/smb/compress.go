@@ -0,0 +1,114 @@
+package smb
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// xzDictCaps maps the presets of the xz tool to their dictionary sizes, which
+// is what sets the ratio of the xz writer.
+var xzDictCaps = [...]int{1: 1 << 20, 2: 2 << 20, 3: 4 << 20, 4: 4 << 20, 5: 8 << 20, 6: 8 << 20, 7: 16 << 20, 8: 32 << 20, 9: 64 << 20}
+
+// archiveWriter takes the content of one file and closes every layer of the
+// compressed stream, innermost first, on Close.
+type archiveWriter struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (a *archiveWriter) Close() error {
+	var errs []error
+	for _, c := range a.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// newArchiveWriter returns the writer the content of a file is copied into to
+// write its compressed form to w, in the format and level of cfg. name and
+// info describe the file for the formats that store them. Closing it
+// finishes the compressed stream but does not close w.
+func newArchiveWriter(cfg *config.Config, w io.Writer, name string, info os.FileInfo) (io.WriteCloser, error) {
+	level := cfg.CompressLevel
+	switch cfg.CompressFormat() {
+	case config.CompressTarGz:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		gz, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, err
+		}
+		return newTarWriter(gz, name, info)
+	case config.CompressTarZst:
+		var opts []zstd.EOption
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		if cfg.CompressThreads > 0 {
+			opts = append(opts, zstd.WithEncoderConcurrency(cfg.CompressThreads))
+		}
+		zw, err := zstd.NewWriter(w, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return newTarWriter(zw, name, info)
+	case config.CompressXz:
+		var xzConfig xz.WriterConfig
+		if level != 0 {
+			xzConfig.DictCap = xzDictCaps[level]
+		}
+		xw, err := xzConfig.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		return &archiveWriter{Writer: xw, closers: []io.Closer{xw}}, nil
+	default:
+		zw := newZipWriter(w, level)
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: info.ModTime()}
+		header.SetMode(info.Mode())
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return nil, err
+		}
+		return &archiveWriter{Writer: entry, closers: []io.Closer{zw}}, nil
+	}
+}
+
+// newZipWriter returns a zip writer that deflates at level, or at the default
+// level when it is 0.
+func newZipWriter(w io.Writer, level int) *zip.Writer {
+	zw := zip.NewWriter(w)
+	if level != 0 {
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+	}
+	return zw
+}
+
+// newTarWriter starts a tar stream holding one file on top of compressed.
+func newTarWriter(compressed io.WriteCloser, name string, info os.FileInfo) (io.WriteCloser, error) {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		compressed.Close()
+		return nil, err
+	}
+	header.Name = name
+	tw := tar.NewWriter(compressed)
+	if err := tw.WriteHeader(header); err != nil {
+		compressed.Close()
+		return nil, fmt.Errorf("failed to write tar header: %w", err)
+	}
+	return &archiveWriter{Writer: tw, closers: []io.Closer{tw, compressed}}, nil
+}
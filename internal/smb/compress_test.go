@@ -0,0 +1,240 @@
+package smb
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// decompress returns the name and content of the single file stored in a
+// compressed copy of the given format.
+func decompress(t *testing.T, format, data string) (name, content string) {
+	t.Helper()
+	r := strings.NewReader(data)
+	var tarStream io.Reader
+	switch format {
+	case config.CompressZip:
+		zr, err := zip.NewReader(r, int64(len(data)))
+		if err != nil || len(zr.File) != 1 {
+			t.Fatalf("Expected a zip with one entry, got %v", err)
+		}
+		f, err := zr.File[0].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		b, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return zr.File[0].Name, string(b)
+	case config.CompressTarGz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tarStream = gz
+	case config.CompressTarZst:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		tarStream = zr
+	case config.CompressXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(xr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "", string(b)
+	}
+
+	tr := tar.NewReader(tarStream)
+	header, err := tr.Next()
+	if err != nil {
+		t.Fatalf("Failed to read tar header: %v", err)
+	}
+	b, err := io.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("Expected a single tar entry, got %v", err)
+	}
+	return header.Name, string(b)
+}
+
+func TestSyncFiles_Compress(t *testing.T) {
+	content := strings.Repeat("INSERT INTO ventas VALUES (1, 'abc');\n", 1000)
+	testCases := []struct {
+		format  string
+		level   int
+		threads int
+		remote  string
+	}{
+		{config.CompressZip, 0, 0, "dump.zip"},
+		{config.CompressZip, 9, 0, "dump.zip"},
+		{config.CompressTarGz, 0, 0, "dump.tar.gz"},
+		{config.CompressTarGz, 1, 0, "dump.tar.gz"},
+		{config.CompressTarZst, 0, 0, "dump.tar.zst"},
+		{config.CompressTarZst, 19, 2, "dump.tar.zst"},
+		{config.CompressXz, 0, 0, "dump.sql.xz"},
+		{config.CompressXz, 3, 0, "dump.sql.xz"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.remote, func(t *testing.T) {
+			localDir := t.TempDir()
+			writeTestFiles(t, localDir, map[string]string{"dump.sql": content})
+			fs := NewMemFS()
+			cfg := &config.Config{
+				Path:            localDir,
+				SharedPath:      ".",
+				DeleteAfter:     true,
+				Compress:        tc.format,
+				CompressLevel:   tc.level,
+				CompressThreads: tc.threads,
+			}
+
+			if err := syncFiles(context.Background(), fs, cfg, []string{"dump.sql"}); err != nil {
+				t.Fatalf("syncFiles failed: %v", err)
+			}
+
+			data := readRemoteFile(t, fs, tc.remote)
+			if len(data) >= len(content) {
+				t.Errorf("Expected %s to be smaller than the source, got %d bytes", tc.remote, len(data))
+			}
+			name, got := decompress(t, tc.format, data)
+			if got != content {
+				t.Errorf("Decompressed content differs from the source")
+			}
+			if tc.format != config.CompressXz && name != "dump.sql" {
+				t.Errorf("Expected the entry to be named dump.sql, got %q", name)
+			}
+
+			entries, err := os.ReadDir(localDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("Expected the original to be deleted, got %v", entries)
+			}
+		})
+	}
+}
+
+func TestRemoteName(t *testing.T) {
+	testCases := []struct {
+		cfg  config.Config
+		want string
+	}{
+		{config.Config{}, filepath.Join("sql", "db.bak")},
+		{config.Config{Zippy: true}, filepath.Join("sql", "db.zip")},
+		{config.Config{Compress: config.CompressTarGz}, filepath.Join("sql", "db.tar.gz")},
+		{config.Config{Compress: config.CompressTarZst}, filepath.Join("sql", "db.tar.zst")},
+		{config.Config{Compress: config.CompressXz}, filepath.Join("sql", "db.bak.xz")},
+	}
+
+	for _, tc := range testCases {
+		job := &syncJob{cfg: &tc.cfg}
+		if got := remoteName(job, filepath.Join("sql", "db.bak")); got != tc.want {
+			t.Errorf("Expected %s, got %s", tc.want, got)
+		}
+	}
+}
+
+func TestSyncFiles_CompressStreamsToShare(t *testing.T) {
+	// Random data does not compress, so the stream spans several sample
+	// blocks.
+	content := make([]byte, 3*sampleBlockSize)
+	rand.NewChaCha8([32]byte{1}).Read(content)
+
+	testCases := []struct {
+		mode    string
+		corrupt bool
+		wantErr bool
+	}{
+		{config.VerifyFull, false, false},
+		{config.VerifyFull, true, true},
+		{config.VerifySample, false, false},
+		{config.VerifySample, true, true},
+	}
+
+	for _, tc := range testCases {
+		name := tc.mode
+		if tc.corrupt {
+			name += " corrupt"
+		}
+		t.Run(name, func(t *testing.T) {
+			localDir := t.TempDir()
+			writeTestFiles(t, localDir, map[string]string{"db.bak": string(content)})
+			fs := &faultyFS{RemoteFS: NewMemFS(), corrupt: tc.corrupt}
+			cfg := &config.Config{Path: localDir, SharedPath: ".", Compress: config.CompressTarZst, VerifyMode: tc.mode, VerifySamples: 2}
+
+			err := syncFiles(context.Background(), fs, cfg, []string{"db.bak"})
+			if tc.wantErr != errors.Is(err, ErrIncomplete) {
+				t.Fatalf("Expected failure %v, got %v", tc.wantErr, err)
+			}
+
+			entries, err := os.ReadDir(localDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name() != "db.bak" {
+				t.Errorf("Expected no compressed copy on the local disk, got %v", entries)
+			}
+			if tc.wantErr {
+				return
+			}
+			if _, got := decompress(t, config.CompressTarZst, readRemoteFile(t, fs, "db.tar.zst")); got != string(content) {
+				t.Errorf("Decompressed content differs from the source")
+			}
+		})
+	}
+}
+
+func TestBlockSums(t *testing.T) {
+	data := make([]byte, 2*sampleBlockSize+100)
+	rand.NewChaCha8([32]byte{2}).Read(data)
+	hasher := jobHasher(&config.Config{})
+
+	sums := newBlockSums(hasher)
+	// Writes that do not line up with the blocks.
+	for p := data; len(p) > 0; {
+		n := min(len(p), 300_000)
+		sums.Write(p[:n])
+		p = p[n:]
+	}
+
+	if size, _ := sums.size(); size != int64(len(data)) {
+		t.Fatalf("Expected size %d, got %d", len(data), size)
+	}
+	for _, off := range []int64{0, sampleBlockSize, 2 * sampleBlockSize} {
+		n := min(sampleBlockSize, int64(len(data))-off)
+		want, _ := hashReader(hasher, bytes.NewReader(data[off:off+n]))
+		got, err := sums.blockSum(off, n)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Block at %d: expected %x, got %x (%v)", off, want, got, err)
+		}
+	}
+	if _, err := sums.blockSum(3*sampleBlockSize, 1); err == nil {
+		t.Error("Expected an error for a block past the end")
+	}
+}
@@ -0,0 +1,78 @@
+package smb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/config"
+)
+
+// errRemoteExists is returned for files rejected by the "fail" conflict policy.
+var errRemoteExists = errors.New("remote file already exists")
+
+// errLocalExists is errRemoteExists for the local copies of pull.
+var errLocalExists = errors.New("local file already exists")
+
+// conflictAction returns what the given --on-conflict policy does with a file
+// whose destination already exists.
+func conflictAction(policy string, sourceInfo, destInfo os.FileInfo) planAction {
+	switch policy {
+	case config.ConflictSkip:
+		return actionSkipExisting
+	case config.ConflictFail:
+		return actionFail
+	case config.ConflictRename:
+		return actionRename
+	case config.ConflictNewer:
+		if sourceInfo.ModTime().After(destInfo.ModTime().Add(mtimeTolerance)) {
+			return actionOverwrite
+		}
+		return actionSkipExisting
+	default:
+		return actionOverwrite
+	}
+}
+
+// freeRemoteName returns remoteFilePath with a timestamp suffix, adding a
+// counter if that name is also taken: name_20060102-150405.ext,
+// name_20060102-150405_1.ext, ... Local paths can be checked through a
+// localFS rooted at "".
+func freeRemoteName(fs RemoteFS, remoteFilePath string, now time.Time) (string, error) {
+	ext := remoteExt(remoteFilePath)
+	base := strings.TrimSuffix(remoteFilePath, ext) + "_" + now.Format("20060102-150405")
+
+	for i := 0; i < 1000; i++ {
+		candidate := base + ext
+		if i > 0 {
+			candidate = fmt.Sprintf("%s_%d%s", base, i, ext)
+		}
+		_, err := fs.Stat(candidate)
+		if errors.Is(err, os.ErrNotExist) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not stat remote file %s: %w", candidate, err)
+		}
+	}
+	return "", fmt.Errorf("no free name found for %s", remoteFilePath)
+}
+
+// remoteExt returns the extension of remoteFilePath, keeping together the
+// compound extensions of compressed copies (.tar.gz, .tar.zst and the
+// original extension before .xz) so the suffix does not split them.
+func remoteExt(remoteFilePath string) string {
+	for _, ext := range []string{"." + config.CompressTarGz, "." + config.CompressTarZst} {
+		if strings.HasSuffix(remoteFilePath, ext) {
+			return ext
+		}
+	}
+	ext := filepath.Ext(remoteFilePath)
+	if ext == "."+config.CompressXz {
+		ext = filepath.Ext(strings.TrimSuffix(remoteFilePath, ext)) + ext
+	}
+	return ext
+}
@@ -0,0 +1,175 @@
+package smb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/config"
+)
+
+func TestSyncFiles_OnConflict(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		remoteAge  time.Duration
+		wantErr    bool
+		wantRemote string
+		wantLocal  bool
+	}{
+		{name: "overwrite", policy: config.ConflictOverwrite, wantRemote: "local"},
+		{name: "default overwrites", policy: "", wantRemote: "local"},
+		{name: "skip", policy: config.ConflictSkip, wantRemote: "remote", wantLocal: true},
+		{name: "fail", policy: config.ConflictFail, wantErr: true, wantRemote: "remote", wantLocal: true},
+		{name: "newer local", policy: config.ConflictNewer, remoteAge: -time.Hour, wantRemote: "local"},
+		{name: "newer remote", policy: config.ConflictNewer, remoteAge: time.Hour, wantRemote: "remote", wantLocal: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localDir := t.TempDir()
+			writeTestFiles(t, localDir, map[string]string{"a.bak": "local"})
+
+			fs := NewMemFS()
+			writeRemoteFile(t, fs, "a.bak", "remote")
+			if tt.remoteAge != 0 {
+				local, err := os.Stat(filepath.Join(localDir, "a.bak"))
+				if err != nil {
+					t.Fatalf("Stat failed: %v", err)
+				}
+				remoteTime := local.ModTime().Add(tt.remoteAge)
+				if err := fs.Chtimes("a.bak", remoteTime, remoteTime); err != nil {
+					t.Fatalf("Chtimes failed: %v", err)
+				}
+			}
+
+			cfg := &config.Config{Path: localDir, SharedPath: ".", DeleteAfter: true, OnConflict: tt.policy}
+			err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"})
+			if tt.wantErr && !errors.Is(err, ErrIncomplete) {
+				t.Errorf("Expected ErrIncomplete, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+
+			if got := readRemoteFile(t, fs, "a.bak"); got != tt.wantRemote {
+				t.Errorf("Expected remote content %q, got %q", tt.wantRemote, got)
+			}
+			_, statErr := os.Stat(filepath.Join(localDir, "a.bak"))
+			if tt.wantLocal && statErr != nil {
+				t.Errorf("Expected local file to be kept, got %v", statErr)
+			}
+			if !tt.wantLocal && statErr == nil {
+				t.Error("Expected local file to be deleted")
+			}
+		})
+	}
+}
+
+func TestSyncFiles_OnConflictRename(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "local"})
+
+	fs := NewMemFS()
+	writeRemoteFile(t, fs, "a.bak", "remote")
+
+	cfg := &config.Config{Path: localDir, SharedPath: ".", OnConflict: config.ConflictRename}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+
+	if got := readRemoteFile(t, fs, "a.bak"); got != "remote" {
+		t.Errorf("Expected existing remote file to be untouched, got %q", got)
+	}
+	infos, err := fs.ReadDir(".")
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	renamed := regexp.MustCompile(`^a_\d{8}-\d{6}\.bak$`)
+	var found string
+	for _, info := range infos {
+		if renamed.MatchString(info.Name()) {
+			found = info.Name()
+		}
+	}
+	if found == "" {
+		t.Fatalf("Expected a renamed copy next to a.bak, got %d entries", len(infos))
+	}
+	if got := readRemoteFile(t, fs, found); got != "local" {
+		t.Errorf("Expected renamed copy to hold local content, got %q", got)
+	}
+}
+
+func TestFreeRemoteName(t *testing.T) {
+	fs := NewMemFS()
+	now := time.Date(2024, 1, 31, 22, 0, 0, 0, time.UTC)
+	writeRemoteFile(t, fs, "a_20240131-220000.bak", "x")
+	writeRemoteFile(t, fs, "a_20240131-220000_1.bak", "x")
+
+	got, err := freeRemoteName(fs, "a.bak", now)
+	if err != nil {
+		t.Fatalf("freeRemoteName failed: %v", err)
+	}
+	if got != "a_20240131-220000_2.bak" {
+		t.Errorf("Expected a_20240131-220000_2.bak, got %s", got)
+	}
+}
+
+func TestFreeRemoteName_CompressedExtensions(t *testing.T) {
+	fs := NewMemFS()
+	now := time.Date(2024, 1, 31, 22, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name string
+		want string
+	}{
+		{"db.tar.gz", "db_20240131-220000.tar.gz"},
+		{"db.tar.zst", "db_20240131-220000.tar.zst"},
+		{"db.bak.xz", "db_20240131-220000.bak.xz"},
+		{"db.xz", "db_20240131-220000.xz"},
+		{"db.zip", "db_20240131-220000.zip"},
+	}
+
+	for _, tc := range testCases {
+		got, err := freeRemoteName(fs, tc.name, now)
+		if err != nil {
+			t.Fatalf("freeRemoteName failed: %v", err)
+		}
+		if got != tc.want {
+			t.Errorf("Expected %s, got %s", tc.want, got)
+		}
+	}
+}
+
+func TestSyncFiles_OnConflictRenameTarGz(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"db.bak": "local"})
+	fs := NewMemFS()
+	writeRemoteFile(t, fs, "db.tar.gz", "remote")
+
+	cfg := &config.Config{Path: localDir, SharedPath: ".", OnConflict: config.ConflictRename, Compress: config.CompressTarGz}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"db.bak"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+
+	infos, err := fs.ReadDir(".")
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	renamed := regexp.MustCompile(`^db_\d{8}-\d{6}\.tar\.gz$`)
+	var found string
+	for _, info := range infos {
+		if renamed.MatchString(info.Name()) {
+			found = info.Name()
+		}
+	}
+	if found == "" {
+		t.Fatalf("Expected a renamed db_<stamp>.tar.gz next to db.tar.gz, got %d entries", len(infos))
+	}
+	if _, got := decompress(t, config.CompressTarGz, readRemoteFile(t, fs, found)); got != "local" {
+		t.Errorf("Expected renamed copy to hold local content, got %q", got)
+	}
+}
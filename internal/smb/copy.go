@@ -1,98 +1,127 @@
 package smb
 
 import (
-	"archive/zip"
-	"crypto/sha256"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
-	"github.com/hirochachacha/go-smb2"
+	"github.com/hvarillas/smbsync/internal/config"
 	"github.com/hvarillas/smbsync/internal/logger"
-	"github.com/k0kubun/go-ansi"
-	"github.com/schollz/progressbar/v3"
 )
 
-func startCopy(fs *smb2.Share, fileName, localBasePath, remoteBasePath string, deleteAfter, zippy bool) error {
-	localFilePath := filepath.Join(localBasePath, fileName)
-	remoteFilePath := filepath.Join(remoteBasePath, fileName)
+// partSuffix marks remote files that are still being written. They only get
+// their final name once the copy has been verified.
+const partSuffix = ".smbsync-part"
 
-	if zippy {
-		logger.Sugar.Infof("Comprimiendo archivo: %s", fileName)
-		zipFileName := strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".zip"
-		zipFilePath := filepath.Join(localBasePath, zipFileName)
-		remoteFilePath = filepath.Join(remoteBasePath, zipFileName)
+// partPath returns the temporary name used while uploading remotePath.
+func partPath(remotePath string) string {
+	return filepath.Join(filepath.Dir(remotePath), "."+filepath.Base(remotePath)+partSuffix)
+}
 
-		zipFile, err := os.Create(zipFilePath)
-		if err != nil {
-			return fmt.Errorf("failed to create zip file: %w", err)
-		}
+// asideSuffix marks a remote file that is being replaced. It only exists
+// between moving the old file out of the way and renaming the new one in.
+const asideSuffix = ".smbsync-old"
 
-		zipWriter := zip.NewWriter(zipFile)
+// asidePath returns the name the existing remotePath is moved to while it is
+// replaced.
+func asidePath(remotePath string) string {
+	return filepath.Join(filepath.Dir(remotePath), "."+filepath.Base(remotePath)+asideSuffix)
+}
 
-		sourceFile, err := os.Open(localFilePath)
-		if err != nil {
-			zipFile.Close()
-			return fmt.Errorf("failed to open source file: %w", err)
-		}
+func isPartFile(name string) bool {
+	return strings.HasPrefix(name, ".") && (strings.HasSuffix(name, partSuffix) || strings.HasSuffix(name, asideSuffix))
+}
 
-		fileInfo, err := sourceFile.Stat()
-		if err != nil {
-			sourceFile.Close()
-			zipFile.Close()
-			return fmt.Errorf("failed to get file info: %w", err)
-		}
+// copyOutcome describes what happened to a file during a run.
+type copyOutcome string
 
-		writer, err := zipWriter.Create(fileName)
-		if err != nil {
-			sourceFile.Close()
-			zipFile.Close()
-			return fmt.Errorf("failed to create zip entry: %w", err)
-		}
+const (
+	outcomeCopied  copyOutcome = "copied"
+	outcomeSkipped copyOutcome = "skipped"
+	outcomeFailed  copyOutcome = "failed"
+)
 
-		bar := progressbar.NewOptions64(
-			fileInfo.Size(),
-			progressbar.OptionSetDescription("Comprimiendo..."),
-			progressbar.OptionSetWriter(ansi.NewAnsiStdout()),
-			progressbar.OptionShowBytes(true),
-			progressbar.OptionSetWidth(40),
-			progressbar.OptionThrottle(100*time.Millisecond),
-			progressbar.OptionShowCount(),
-			progressbar.OptionClearOnFinish(),
-			progressbar.OptionEnableColorCodes(true),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "[green]█[reset]",
-				SaucerHead:    "[green]█[reset]",
-				SaucerPadding: "░",
-				BarStart:      "|",
-				BarEnd:        "|",
-			}),
-		)
-
-		_, err = io.Copy(io.MultiWriter(writer, bar), sourceFile)
-		
-		sourceFile.Close()
-		zipWriter.Close()
-		zipFile.Close()
-		
+// remoteName returns the name fileName gets on the share. Compressed copies
+// replace the extension with the one of the format, except xz, which does not
+// store the name of the file.
+func remoteName(job *syncJob, fileName string) string {
+	switch format := job.cfg.CompressFormat(); format {
+	case "":
+		return fileName
+	case config.CompressXz:
+		return fileName + "." + format
+	default:
+		return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + "." + format
+	}
+}
+
+func startCopy(job *syncJob, fileName string, t *transfer) (copyOutcome, error) {
+	plan, err := planFile(job, fileName)
+	if err != nil {
+		return outcomeFailed, err
+	}
+	t.destination = plan.target
+
+	switch plan.action {
+	case actionSkipUnchanged:
+		logger.Sugar.Infof("Archivo %s sin cambios en el destino, se omite la copia", fileName)
+		if !plan.verified {
+			if job.cfg.DeleteAfter {
+				logger.Sugar.Infof("Se conserva el archivo local %s: la omisión no se verificó por hash", fileName)
+			}
+			return outcomeSkipped, nil
+		}
+		deleted, err := deleteLocal(job, fileName)
 		if err != nil {
-			return fmt.Errorf("failed to copy to zip: %w", err)
+			return outcomeFailed, err
 		}
+		t.deleted = deleted
+		return outcomeSkipped, nil
+	case actionSkipExisting:
+		logger.Sugar.Infof("Conflicto en %s: el archivo remoto ya existe, se omite", plan.remotePath)
+		return outcomeSkipped, nil
+	case actionFail:
+		logger.Sugar.Errorf("Conflicto en %s: el archivo remoto ya existe", plan.remotePath)
+		return outcomeFailed, fmt.Errorf("%w: %s", errRemoteExists, plan.remotePath)
+	case actionOverwrite:
+		logger.Sugar.Infof("Conflicto en %s: el archivo remoto se sobrescribe", plan.remotePath)
+	case actionRename:
+		logger.Sugar.Infof("Conflicto en %s: se copiará %s como %s", plan.remotePath, fileName, filepath.Base(plan.target))
+	}
 
-		localFilePath = zipFilePath
-		logger.Sugar.Infof("Archivo comprimido exitosamente: %s", zipFileName)
+	if err := uploadFile(job, fileName, plan.localPath, plan.target, plan.sourceInfo, t); err != nil {
+		return outcomeFailed, err
 	}
+	return outcomeCopied, nil
+}
+
+// uploadFile copies fileName to a temporary remote name, compressing it on
+// the way if requested, verifies it and moves it to remoteFilePath.
+func uploadFile(job *syncJob, fileName, localFilePath, remoteFilePath string, sourceInfo os.FileInfo, t *transfer) error {
+	fs := job.fs
+	format := job.cfg.CompressFormat()
 
 	logger.Sugar.Infof("Iniciando copia de archivo: %s", filepath.Base(localFilePath))
 	logger.Sugar.Debugf("Ruta local: %s -> Ruta remota: %s", localFilePath, remoteFilePath)
+	partFilePath := partPath(remoteFilePath)
 
 	var sourceHashSum []byte
 	var localFile *os.File
-	var remoteFile *smb2.File
-	
+	var remoteFile RemoteFile
+	// A compressed copy exists nowhere but on the share, so sample mode
+	// compares it with the hashes of its blocks taken while it was written.
+	var sample sampleSource = localBlocks{path: localFilePath, hasher: job.hasher}
+	if format != "" {
+		sample = nil
+		if job.cfg.VerifyMode == config.VerifySample {
+			sample = newBlockSums(job.hasher)
+		}
+	}
+
 	err := func() error {
 		var err error
 		localFile, err = os.Open(localFilePath)
@@ -109,44 +138,62 @@ func startCopy(fs *smb2.Share, fileName, localBasePath, remoteBasePath string, d
 		fileSize := fileInfo.Size()
 		logger.Sugar.Infof("Tamaño del archivo %s: %d bytes (%.2f MB)", fileName, fileSize, float64(fileSize)/(1024*1024))
 
-		remoteFile, err = fs.Create(remoteFilePath)
+		if err := fs.MkdirAll(filepath.Dir(remoteFilePath), 0755); err != nil {
+			logger.Sugar.Errorf("Error al crear directorio remoto %s: %v", filepath.Dir(remoteFilePath), err)
+			return fmt.Errorf("could not create remote directory %s: %w", filepath.Dir(remoteFilePath), err)
+		}
+
+		sourceHash := job.hasher.New()
+		if format != "" {
+			var written int64
+			remoteFile, written, err = uploadCompressed(job, localFile, fileInfo, fileName, partFilePath, sourceHash, sample)
+			if err != nil {
+				return err
+			}
+			logger.Sugar.Infof("Copia completada para %s (%d bytes comprimidos en %s, %.1f%% del original)",
+				fileName, written, format, 100*float64(written)/float64(max(fileSize, 1)))
+			t.bytes = written
+			sourceHashSum = sourceHash.Sum(nil)
+			t.sourceHash = sourceHashSum
+			logger.Sugar.Debugf("Hash %s del archivo comprimido: %x", job.hasher.Name(), sourceHashSum)
+			return nil
+		}
+
+		var offset int64
+		remoteFile, offset, err = openForResume(fs, job.journal, partFilePath, sourceInfo, localFile, fileSize, job.hasher, sourceHash)
 		if err != nil {
-			logger.Sugar.Errorf("Error al crear archivo remoto %s: %v", remoteFilePath, err)
-			return fmt.Errorf("could not create remote file %s: %w", remoteFilePath, err)
+			logger.Sugar.Errorf("Error al crear archivo remoto %s: %v", partFilePath, err)
+			return fmt.Errorf("could not create remote file %s: %w", partFilePath, err)
 		}
 
-		logger.Sugar.Info("Fase: Copiando archivo y calculando hash SHA256")
-		sourceHash := sha256.New()
-
-		bar := progressbar.NewOptions64(
-			fileSize,
-			progressbar.OptionSetDescription("Copiando..."),
-			progressbar.OptionSetWriter(ansi.NewAnsiStdout()),
-			progressbar.OptionShowBytes(true),
-			progressbar.OptionSetWidth(40),
-			progressbar.OptionThrottle(100*time.Millisecond),
-			progressbar.OptionShowCount(),
-			progressbar.OptionClearOnFinish(),
-			progressbar.OptionEnableColorCodes(true),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "[green]█[reset]",
-				SaucerHead:    "[green]█[reset]",
-				SaucerPadding: "░",
-				BarStart:      "|",
-				BarEnd:        "|",
-			}),
-		)
+		logger.Sugar.Infof("Fase: Copiando archivo y calculando hash %s", job.hasher.Name())
+		bar := job.copyProgress(fileSize, offset)
 
 		destWriter := io.MultiWriter(remoteFile, sourceHash, bar)
+		if job.journal != nil {
+			progress := &journalWriter{
+				journal:    job.journal,
+				remotePath: partFilePath,
+				localPath:  localFilePath,
+				local:      sourceInfo,
+				offset:     offset,
+				saved:      offset,
+			}
+			progress.checkpoint()
+			defer progress.checkpoint()
+			destWriter = io.MultiWriter(remoteFile, sourceHash, bar, progress)
+		}
 
-		if _, err := io.Copy(destWriter, localFile); err != nil {
+		if _, err := io.Copy(destWriter, job.limiter.Reader(localFile)); err != nil {
 			logger.Sugar.Errorf("Error durante la copia del archivo %s: %v", fileName, err)
 			return fmt.Errorf("file copy failed: %w", err)
 		}
 
-		logger.Sugar.Infof("Copia completada para %s (%d bytes transferidos)", fileName, fileSize)
+		logger.Sugar.Infof("Copia completada para %s (%d bytes transferidos)", fileName, fileSize-offset)
+		t.bytes = fileSize - offset
 		sourceHashSum = sourceHash.Sum(nil)
-		logger.Sugar.Debugf("Hash SHA256 del archivo origen: %x", sourceHashSum)
+		t.sourceHash = sourceHashSum
+		logger.Sugar.Debugf("Hash %s del archivo origen: %x", job.hasher.Name(), sourceHashSum)
 		return nil
 	}()
 
@@ -158,8 +205,95 @@ func startCopy(fs *smb2.Share, fileName, localBasePath, remoteBasePath string, d
 	}
 
 	if err != nil {
+		// Keep the partial upload around when it can be resumed later.
+		if job.journal == nil {
+			removePart(job, partFilePath)
+		}
 		return err
 	}
 
-	return verifyIntegrity(fs, remoteFilePath, sourceHashSum, fileName, localBasePath, deleteAfter, zippy)
+	destHashSum, err := verifyIntegrity(job, partFilePath, sample, sourceHashSum, fileName)
+	t.destHash = destHashSum
+	if err != nil {
+		removePart(job, partFilePath)
+		return err
+	}
+
+	logger.Sugar.Debugf("Renombrando %s a %s", partFilePath, remoteFilePath)
+	if err := fs.Rename(partFilePath, remoteFilePath); err != nil {
+		logger.Sugar.Errorf("Error al renombrar archivo remoto %s a %s: %v", partFilePath, remoteFilePath, err)
+		removePart(job, partFilePath)
+		return fmt.Errorf("could not rename remote file to %s: %w", remoteFilePath, err)
+	}
+	if err := job.journal.forget(partFilePath); err != nil {
+		logger.Sugar.Warnf("No se pudo actualizar el diario de reanudación: %v", err)
+	}
+	if err := fs.Chtimes(remoteFilePath, sourceInfo.ModTime(), sourceInfo.ModTime()); err != nil {
+		logger.Sugar.Warnf("No se pudo conservar la fecha de modificación de %s: %v", remoteFilePath, err)
+	}
+	// The copy matches the source hash in every verify mode that read it.
+	job.recordManifest(remoteFilePath, sourceHashSum)
+
+	deleted, err := deleteLocal(job, fileName)
+	if err != nil {
+		return err
+	}
+	t.deleted = deleted
+	return nil
+}
+
+// uploadCompressed streams the compressed form of localFile into a new remote
+// file at partFilePath, hashing the compressed bytes into sourceHash and
+// sample, so no compressed copy is written to the local disk. It returns the
+// remote file, for the caller to close, and the number of bytes written to it.
+func uploadCompressed(job *syncJob, localFile *os.File, fileInfo os.FileInfo, fileName, partFilePath string, sourceHash hash.Hash, sample sampleSource) (RemoteFile, int64, error) {
+	remoteFile, err := job.fs.Create(partFilePath)
+	if err != nil {
+		logger.Sugar.Errorf("Error al crear archivo remoto %s: %v", partFilePath, err)
+		return nil, 0, fmt.Errorf("could not create remote file %s: %w", partFilePath, err)
+	}
+
+	format := job.cfg.CompressFormat()
+	logger.Sugar.Infof("Fase: Comprimiendo en %s directamente en el destino y calculando hash %s", format, job.hasher.Name())
+	written := &countingWriter{}
+	dest := io.MultiWriter(job.limiter.Writer(remoteFile), sourceHash, written)
+	if w, ok := sample.(io.Writer); ok {
+		dest = io.MultiWriter(dest, w)
+	}
+	archive, err := newArchiveWriter(job.cfg, dest, filepath.Base(fileName), fileInfo)
+	if err != nil {
+		return remoteFile, 0, fmt.Errorf("failed to start %s stream: %w", format, err)
+	}
+
+	bar := job.copyProgress(fileInfo.Size(), 0)
+	if _, err := io.Copy(archive, io.TeeReader(localFile, bar)); err != nil {
+		archive.Close()
+		logger.Sugar.Errorf("Error durante la copia del archivo %s: %v", fileName, err)
+		return remoteFile, 0, fmt.Errorf("compressed copy failed: %w", err)
+	}
+	if err := archive.Close(); err != nil {
+		return remoteFile, 0, fmt.Errorf("failed to finish %s stream: %w", format, err)
+	}
+	return remoteFile, written.n, nil
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// removePart deletes a temporary remote file that must not be kept.
+func removePart(job *syncJob, partFilePath string) {
+	logger.Sugar.Infof("Eliminando archivo temporal remoto: %s", partFilePath)
+	if err := job.fs.Remove(partFilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Sugar.Warnf("No se pudo eliminar el archivo temporal remoto %s: %v", partFilePath, err)
+	}
+	if err := job.journal.forget(partFilePath); err != nil {
+		logger.Sugar.Warnf("No se pudo actualizar el diario de reanudación: %v", err)
+	}
 }
@@ -0,0 +1,142 @@
+package smb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hvarillas/smbsync/internal/config"
+)
+
+// faultyFS corrupts or fails writes to exercise the error paths of startCopy.
+type faultyFS struct {
+	RemoteFS
+	corrupt   bool
+	failAfter int
+}
+
+type faultyFile struct {
+	RemoteFile
+	fs      *faultyFS
+	written int
+}
+
+func (f *faultyFS) Create(name string) (RemoteFile, error) {
+	file, err := f.RemoteFS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyFile{RemoteFile: file, fs: f}, nil
+}
+
+func (f *faultyFile) Write(p []byte) (int, error) {
+	if f.fs.failAfter > 0 && f.written+len(p) > f.fs.failAfter {
+		return 0, errors.New("connection reset")
+	}
+	f.written += len(p)
+	if f.fs.corrupt {
+		corrupted := append([]byte(nil), p...)
+		corrupted[0] ^= 0xff
+		return f.RemoteFile.Write(corrupted)
+	}
+	return f.RemoteFile.Write(p)
+}
+
+func TestPartPath(t *testing.T) {
+	testCases := []struct {
+		remote   string
+		expected string
+	}{
+		{"backup.bak", ".backup.bak.smbsync-part"},
+		{"dir/sub/db.zip", filepath.Join("dir", "sub", ".db.zip.smbsync-part")},
+	}
+	for _, tc := range testCases {
+		if got := partPath(tc.remote); got != tc.expected {
+			t.Errorf("partPath(%q) = %q, expected %q", tc.remote, got, tc.expected)
+		}
+		if !isPartFile(filepath.Base(partPath(tc.remote))) {
+			t.Errorf("isPartFile should recognise %q", partPath(tc.remote))
+		}
+	}
+	if isPartFile("backup.bak") {
+		t.Error("isPartFile should not match regular files")
+	}
+}
+
+func TestStartCopy_LeavesNoPartFileOnSuccess(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "content"})
+
+	fs := NewMemFS()
+	cfg := &config.Config{Path: localDir, SharedPath: "out"}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+
+	entries, _ := fs.ReadDir("out")
+	if len(entries) != 1 || entries[0].Name() != "a.bak" {
+		t.Errorf("Expected only the final file on the share, got %v", entries)
+	}
+}
+
+func TestStartCopy_VerificationFailureRemovesPartFile(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "content"})
+
+	fs := &faultyFS{RemoteFS: NewMemFS(), corrupt: true}
+	writeRemoteFile(t, fs.RemoteFS, "a.bak", "previous good copy")
+
+	cfg := &config.Config{Path: localDir, SharedPath: ".", DeleteAfter: true}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"}); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Expected ErrIncomplete, got %v", err)
+	}
+
+	if _, err := fs.Stat(partPath("a.bak")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected temporary file to be removed, got %v", err)
+	}
+	if got := readRemoteFile(t, fs, "a.bak"); got != "previous good copy" {
+		t.Errorf("Existing remote file must be untouched by a failed copy, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(localDir, "a.bak")); err != nil {
+		t.Errorf("Local file must be kept after a failed verification: %v", err)
+	}
+}
+
+func TestStartCopy_CopyFailure(t *testing.T) {
+	testCases := []struct {
+		name     string
+		resume   bool
+		keepPart bool
+	}{
+		{"without resume removes part file", false, false},
+		{"with resume keeps part file", true, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			localDir := t.TempDir()
+			writeTestFiles(t, localDir, map[string]string{"a.bak": "0123456789"})
+
+			fs := &faultyFS{RemoteFS: NewMemFS(), failAfter: 5}
+			cfg := &config.Config{
+				Path:        localDir,
+				SharedPath:  ".",
+				Resume:      tc.resume,
+				ResumeState: filepath.Join(t.TempDir(), "resume.json"),
+			}
+			if err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"}); !errors.Is(err, ErrIncomplete) {
+				t.Fatalf("Expected ErrIncomplete, got %v", err)
+			}
+
+			_, err := fs.Stat(partPath("a.bak"))
+			if kept := err == nil; kept != tc.keepPart {
+				t.Errorf("Expected part file kept=%v, got %v (%v)", tc.keepPart, kept, err)
+			}
+			if _, err := fs.Stat("a.bak"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Final remote name must not exist after a failed copy, got %v", err)
+			}
+		})
+	}
+}
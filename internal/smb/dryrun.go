@@ -0,0 +1,85 @@
+package smb
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+)
+
+// dryRun logs the plan for every file without writing to the destination or
+// deleting local files. fs may be nil to plan without connecting, in which
+// case every file is reported as a plain copy.
+func dryRun(fs RemoteFS, cfg *config.Config, files []string) ([]filePlan, error) {
+	job := &syncJob{ctx: context.Background(), cfg: cfg, fs: fs, verifiedLocal: map[string]bool{}, hasher: jobHasher(cfg)}
+	if fs == nil {
+		logger.Sugar.Info("[simulación] Modo sin conexión: no se consulta el destino")
+	} else {
+		logger.Sugar.Info("[simulación] No se escribirá nada en el destino ni se eliminarán archivos locales")
+	}
+
+	localKeep, _ := cfg.LocalRetentionPolicy()
+	var (
+		plans    []filePlan
+		counts   = map[planAction]int{}
+		deletes  int
+		failed   int
+		verified = map[string]bool{}
+	)
+	for _, file := range files {
+		plan, err := planFile(job, file)
+		if err != nil {
+			logger.Sugar.Errorf("[simulación] %s: no se pudo planificar: %v", file, err)
+			failed++
+			continue
+		}
+		plans = append(plans, plan)
+		counts[plan.action]++
+
+		logger.Sugar.Infof("[simulación] %s -> %s: %s", file, plan.remotePath, describeAction(plan))
+		if plan.deletesLocal(cfg.DeleteAfter) {
+			if localKeep.Enabled() {
+				verified[file] = true
+				continue
+			}
+			deletes++
+			logger.Sugar.Infof("[simulación] %s: se eliminaría el archivo local %s", file, plan.localPath)
+		}
+	}
+	if localKeep.Enabled() {
+		for _, file := range localPrune(cfg.Path, localKeep, files, verified) {
+			deletes++
+			logger.Sugar.Infof("[simulación] %s: la retención local eliminaría el archivo local %s", file, filepath.Join(cfg.Path, file))
+		}
+	}
+
+	logger.Sugar.Infof("[simulación] Resumen: %d a copiar, %d a sobrescribir, %d a renombrar, %d a omitir, %d fallarían, %d archivos locales a eliminar",
+		counts[actionCopy], counts[actionOverwrite], counts[actionRename],
+		counts[actionSkipUnchanged]+counts[actionSkipExisting], counts[actionFail]+failed, deletes)
+
+	if failed > 0 {
+		return plans, fmt.Errorf("%w: %d of %d could not be planned", ErrIncomplete, failed, len(files))
+	}
+	return plans, nil
+}
+
+func describeAction(plan filePlan) string {
+	switch plan.action {
+	case actionOverwrite:
+		return "se sobrescribiría el archivo remoto"
+	case actionRename:
+		return fmt.Sprintf("el archivo remoto existe, se copiaría como %s", plan.target)
+	case actionSkipUnchanged:
+		return "sin cambios, se omitiría"
+	case actionSkipExisting:
+		return "el archivo remoto existe, se omitiría"
+	case actionFail:
+		return "el archivo remoto existe, fallaría (--on-conflict fail)"
+	}
+	if !plan.checked {
+		return "se copiaría (destino no consultado)"
+	}
+	return "se copiaría"
+}
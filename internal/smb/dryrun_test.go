@@ -0,0 +1,137 @@
+package smb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hvarillas/smbsync/internal/config"
+)
+
+func TestDryRun_WritesNothing(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{
+		"new.bak":      "new",
+		"same.bak":     "same",
+		"existing.bak": "local",
+	})
+
+	fs := &countingFS{RemoteFS: NewMemFS()}
+	writeRemoteFile(t, fs.RemoteFS, "same.bak", "same")
+	writeRemoteFile(t, fs.RemoteFS, "existing.bak", "remote")
+	written := fs.written
+
+	cfg := &config.Config{
+		Path:        localDir,
+		SharedPath:  ".",
+		DeleteAfter: true,
+		Incremental: true,
+		CompareMode: config.CompareHash,
+		OnConflict:  config.ConflictSkip,
+		DryRun:      true,
+	}
+	plans, err := dryRun(fs, cfg, []string{"new.bak", "same.bak", "existing.bak"})
+	if err != nil {
+		t.Fatalf("dryRun failed: %v", err)
+	}
+
+	want := map[string]struct {
+		action  planAction
+		deletes bool
+	}{
+		"new.bak":      {actionCopy, true},
+		"same.bak":     {actionSkipUnchanged, true},
+		"existing.bak": {actionSkipExisting, false},
+	}
+	if len(plans) != len(want) {
+		t.Fatalf("Expected %d plans, got %d", len(want), len(plans))
+	}
+	for _, plan := range plans {
+		w := want[plan.file]
+		if plan.action != w.action {
+			t.Errorf("Expected %s for %s, got %s", w.action, plan.file, plan.action)
+		}
+		if got := plan.deletesLocal(cfg.DeleteAfter); got != w.deletes {
+			t.Errorf("Expected deletesLocal=%v for %s, got %v", w.deletes, plan.file, got)
+		}
+	}
+
+	if fs.written != written {
+		t.Errorf("Expected no remote writes, got %d bytes", fs.written-written)
+	}
+	if _, err := fs.Stat("new.bak"); !os.IsNotExist(err) {
+		t.Errorf("Expected new.bak not to be created remotely, got %v", err)
+	}
+	for name := range want {
+		if _, err := os.Stat(filepath.Join(localDir, name)); err != nil {
+			t.Errorf("Expected local file %s to be kept, got %v", name, err)
+		}
+	}
+}
+
+func TestDryRun_ZipAndRename(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"db.sql": "dump"})
+
+	fs := NewMemFS()
+	writeRemoteFile(t, fs, "db.zip", "old")
+
+	cfg := &config.Config{Path: localDir, SharedPath: ".", Zippy: true, OnConflict: config.ConflictRename}
+	plans, err := dryRun(fs, cfg, []string{"db.sql"})
+	if err != nil {
+		t.Fatalf("dryRun failed: %v", err)
+	}
+	if len(plans) != 1 {
+		t.Fatalf("Expected 1 plan, got %d", len(plans))
+	}
+	if plans[0].remotePath != "db.zip" {
+		t.Errorf("Expected remote path db.zip, got %s", plans[0].remotePath)
+	}
+	if plans[0].action != actionRename || plans[0].target == "db.zip" {
+		t.Errorf("Expected a rename away from db.zip, got %s to %s", plans[0].action, plans[0].target)
+	}
+	if _, err := os.Stat(filepath.Join(localDir, "db.zip")); !os.IsNotExist(err) {
+		t.Errorf("Expected no local zip to be created, got %v", err)
+	}
+}
+
+func TestDryRun_Offline(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "alpha"})
+
+	cfg := &config.Config{Path: localDir, SharedPath: "backups", DeleteAfter: true, DryRun: true, Offline: true}
+	plans, err := dryRun(nil, cfg, []string{"a.bak"})
+	if err != nil {
+		t.Fatalf("dryRun failed: %v", err)
+	}
+	if len(plans) != 1 || plans[0].checked {
+		t.Fatalf("Expected one unchecked plan, got %+v", plans)
+	}
+	if plans[0].remotePath != filepath.Join("backups", "a.bak") {
+		t.Errorf("Expected remote path backups/a.bak, got %s", plans[0].remotePath)
+	}
+	if !plans[0].deletesLocal(cfg.DeleteAfter) {
+		t.Error("Expected the local file to be reported as deleted")
+	}
+}
+
+func TestRunHeadless_DryRunLocalTarget(t *testing.T) {
+	localDir := t.TempDir()
+	targetDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "alpha"})
+
+	cfg := &config.Config{Path: localDir, Regex: `\.bak$`, SharedPath: ".", TargetDir: targetDir, DeleteAfter: true, DryRun: true}
+	if err := RunHeadless(cfg); err != nil {
+		t.Fatalf("RunHeadless failed: %v", err)
+	}
+	entries, err := os.ReadDir(targetDir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected an empty target, got %d entries", len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(localDir, "a.bak")); err != nil {
+		t.Errorf("Expected local file to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package smb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// RemoteFile is an open file on the destination filesystem.
+type RemoteFile interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Seeker
+	io.Closer
+	Stat() (os.FileInfo, error)
+}
+
+// RemoteFS is the destination side of a sync. Names are relative to the root
+// of the filesystem and may use either slash or the OS separator.
+type RemoteFS interface {
+	Create(name string) (RemoteFile, error)
+	Open(name string) (RemoteFile, error)
+	OpenFile(name string, flag int, perm os.FileMode) (RemoteFile, error)
+	Stat(name string) (os.FileInfo, error)
+	MkdirAll(name string, perm os.FileMode) error
+	// Rename renames oldname to newname, replacing newname if it exists.
+	Rename(oldname, newname string) error
+	Remove(name string) error
+	Chtimes(name string, atime, mtime time.Time) error
+	ReadDir(name string) ([]os.FileInfo, error)
+}
+
+type smbFS struct {
+	share *smb2.Share
+}
+
+// NewSMBFS adapts a mounted SMB share to RemoteFS.
+func NewSMBFS(share *smb2.Share) RemoteFS {
+	return &smbFS{share: share}
+}
+
+func (s *smbFS) Create(name string) (RemoteFile, error) {
+	f, err := s.share.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *smbFS) Open(name string) (RemoteFile, error) {
+	f, err := s.share.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *smbFS) OpenFile(name string, flag int, perm os.FileMode) (RemoteFile, error) {
+	f, err := s.share.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *smbFS) Stat(name string) (os.FileInfo, error) {
+	return s.share.Stat(name)
+}
+
+func (s *smbFS) MkdirAll(name string, perm os.FileMode) error {
+	return s.share.MkdirAll(name, perm)
+}
+
+func (s *smbFS) Rename(oldname, newname string) error {
+	return replaceRename(s.share, oldname, newname)
+}
+
+// renamer is the part of a share that replaceRename needs.
+type renamer interface {
+	Rename(oldname, newname string) error
+	Remove(name string) error
+	Stat(name string) (os.FileInfo, error)
+}
+
+// replaceRename renames oldname to newname on a filesystem that refuses to
+// rename over an existing file, as SMB does. The existing newname is moved
+// aside and only removed once oldname has taken its place; if that rename
+// fails, it is moved back.
+func replaceRename(r renamer, oldname, newname string) error {
+	err := r.Rename(oldname, newname)
+	if err == nil {
+		return nil
+	}
+	if _, statErr := r.Stat(newname); statErr != nil {
+		return err
+	}
+	aside := asidePath(newname)
+	if err := r.Rename(newname, aside); err != nil {
+		return err
+	}
+	if err := r.Rename(oldname, newname); err != nil {
+		if restoreErr := r.Rename(aside, newname); restoreErr != nil {
+			return fmt.Errorf("%w (previous file left at %s: %w)", err, aside, restoreErr)
+		}
+		return err
+	}
+	// The new file is already in place; a leftover copy of the old one is
+	// skipped like any other partial file.
+	_ = r.Remove(aside)
+	return nil
+}
+
+func (s *smbFS) Chtimes(name string, atime, mtime time.Time) error {
+	return s.share.Chtimes(name, atime, mtime)
+}
+
+func (s *smbFS) Remove(name string) error {
+	return s.share.Remove(name)
+}
+
+func (s *smbFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return s.share.ReadDir(name)
+}
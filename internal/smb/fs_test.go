@@ -0,0 +1,181 @@
+package smb
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// testRemoteFS runs the same contract checks against every RemoteFS backend.
+func testRemoteFS(t *testing.T, fs RemoteFS) {
+	if err := fs.MkdirAll("a/b", 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+
+	f, err := fs.Create("a/b/file.txt")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := f.Write([]byte("hello world")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	info, err := fs.Stat("a/b/file.txt")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Size() != 11 || info.IsDir() {
+		t.Errorf("Unexpected file info: size=%d dir=%v", info.Size(), info.IsDir())
+	}
+
+	f, err = fs.Open("a/b/file.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := f.ReadAt(buf, 6); err != nil && err != io.EOF {
+		t.Fatalf("ReadAt failed: %v", err)
+	}
+	if string(buf) != "world" {
+		t.Errorf("Expected 'world', got %q", buf)
+	}
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if string(content) != "hello world" {
+		t.Errorf("Expected 'hello world', got %q", content)
+	}
+	f.Close()
+
+	other, err := fs.Create("a/b/other.txt")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	other.Write([]byte("replacement"))
+	other.Close()
+
+	if err := fs.Rename("a/b/other.txt", "a/b/file.txt"); err != nil {
+		t.Fatalf("Rename over existing file failed: %v", err)
+	}
+	if _, err := fs.Stat("a/b/other.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected old name to be gone, got %v", err)
+	}
+
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := fs.Chtimes("a/b/file.txt", mtime, mtime); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	if info, _ := fs.Stat("a/b/file.txt"); !info.ModTime().Equal(mtime) {
+		t.Errorf("Expected mtime %v, got %v", mtime, info.ModTime())
+	}
+
+	entries, err := fs.ReadDir("a/b")
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "file.txt" || entries[0].Size() != 11 {
+		t.Errorf("Unexpected directory listing: %v", entries)
+	}
+
+	if err := fs.Remove("a/b/file.txt"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := fs.Open("a/b/file.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist after remove, got %v", err)
+	}
+	if _, err := fs.Create("missing/dir/file.txt"); err == nil {
+		t.Error("Expected error creating a file in a missing directory")
+	}
+}
+
+func TestMemFS(t *testing.T) {
+	testRemoteFS(t, NewMemFS())
+}
+
+func TestLocalFS(t *testing.T) {
+	testRemoteFS(t, NewLocalFS(t.TempDir()))
+}
+
+func TestMemFS_SeekAndOverwrite(t *testing.T) {
+	fs := NewMemFS()
+	f, err := fs.Create("file.bin")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("0123456789"))
+	if _, err := f.Seek(4, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	f.Write([]byte("xx"))
+
+	info, _ := f.Stat()
+	if info.Size() != 10 {
+		t.Errorf("Expected size 10, got %d", info.Size())
+	}
+
+	buf := make([]byte, 10)
+	f.ReadAt(buf, 0)
+	if string(buf) != "0123xx6789" {
+		t.Errorf("Expected '0123xx6789', got %q", buf)
+	}
+}
+
+// noReplaceFS refuses to rename over an existing file, like an SMB share, and
+// can fail the rename of one particular file.
+type noReplaceFS struct {
+	RemoteFS
+	failFrom string
+}
+
+func (f *noReplaceFS) Rename(oldname, newname string) error {
+	if oldname == f.failFrom {
+		return errors.New("rename failed")
+	}
+	if _, err := f.Stat(newname); err == nil {
+		return os.ErrExist
+	}
+	return f.RemoteFS.Rename(oldname, newname)
+}
+
+func TestReplaceRename_ReplacesExisting(t *testing.T) {
+	fs := &noReplaceFS{RemoteFS: NewMemFS()}
+	fs.MkdirAll("dir", 0755)
+	writeRemoteFile(t, fs, "dir/file.txt", "old")
+	writeRemoteFile(t, fs, "dir/new.txt", "new")
+
+	if err := replaceRename(fs, "dir/new.txt", "dir/file.txt"); err != nil {
+		t.Fatalf("replaceRename failed: %v", err)
+	}
+	if got := readRemoteFile(t, fs, "dir/file.txt"); got != "new" {
+		t.Errorf("Expected 'new', got %q", got)
+	}
+	entries, _ := fs.ReadDir("dir")
+	if len(entries) != 1 {
+		t.Errorf("Expected only the renamed file to remain, got %d entries", len(entries))
+	}
+}
+
+func TestReplaceRename_KeepsExistingOnFailure(t *testing.T) {
+	fs := &noReplaceFS{RemoteFS: NewMemFS(), failFrom: "dir/new.txt"}
+	fs.MkdirAll("dir", 0755)
+	writeRemoteFile(t, fs, "dir/file.txt", "old")
+	writeRemoteFile(t, fs, "dir/new.txt", "new")
+
+	if err := replaceRename(fs, "dir/new.txt", "dir/file.txt"); err == nil {
+		t.Fatal("Expected replaceRename to fail")
+	}
+	if got := readRemoteFile(t, fs, "dir/file.txt"); got != "old" {
+		t.Errorf("Expected the existing file to be restored, got %q", got)
+	}
+	if _, err := fs.Stat(asidePath("dir/file.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no leftover aside file, got %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package smb
+
+import (
+	"io/fs"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+func isHiddenDir(entry fs.DirEntry) bool {
+	if strings.HasPrefix(entry.Name(), ".") {
+		return true
+	}
+
+	info, err := entry.Info()
+	if err != nil {
+		return false
+	}
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return false
+	}
+	return attrs.FileAttributes&(windows.FILE_ATTRIBUTE_HIDDEN|windows.FILE_ATTRIBUTE_SYSTEM) != 0
+}
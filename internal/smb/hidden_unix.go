@@ -0,0 +1,12 @@
+//go:build !windows
+
+package smb
+
+import (
+	"io/fs"
+	"strings"
+)
+
+func isHiddenDir(entry fs.DirEntry) bool {
+	return strings.HasPrefix(entry.Name(), ".")
+}
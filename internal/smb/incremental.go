@@ -0,0 +1,88 @@
+package smb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/checksum"
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+)
+
+// mtimeTolerance absorbs the timestamp granularity of the file systems behind
+// SMB shares (FAT stores modification times with 2 second precision).
+const mtimeTolerance = 2 * time.Second
+
+// checkUnchanged reports whether remoteFilePath already holds the current
+// version of the local file. verified is true when that was established by
+// comparing hashes rather than size and modification time. Any error
+// is logged and treated as "changed" so the file gets copied.
+func checkUnchanged(job *syncJob, localFilePath string, sourceInfo os.FileInfo, remoteFilePath string) (unchanged, verified bool) {
+	remoteInfo, err := job.fs.Stat(remoteFilePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Sugar.Warnf("No se pudo consultar el archivo remoto %s: %v", remoteFilePath, err)
+		}
+		return false, false
+	}
+	if remoteInfo.IsDir() {
+		return false, false
+	}
+
+	diff := remoteInfo.ModTime().Sub(sourceInfo.ModTime())
+	mtimeMatches := diff >= -mtimeTolerance && diff <= mtimeTolerance
+
+	// The size of a compressed copy says nothing about the source, and its
+	// hash differs from the source hash, so only the timestamp can be used.
+	if job.cfg.CompressFormat() != "" {
+		return mtimeMatches, false
+	}
+
+	if remoteInfo.Size() != sourceInfo.Size() {
+		logger.Sugar.Debugf("Tamaño distinto para %s: local %d, remoto %d", localFilePath, sourceInfo.Size(), remoteInfo.Size())
+		return false, false
+	}
+
+	if job.cfg.CompareMode != config.CompareHash {
+		return mtimeMatches, false
+	}
+
+	same, err := sameContent(job.fs, job.hasher, localFilePath, remoteFilePath)
+	if err != nil {
+		logger.Sugar.Warnf("No se pudo comparar el hash de %s con el remoto: %v", localFilePath, err)
+		return false, false
+	}
+	return same, same
+}
+
+// sameContent compares the hash of a local file and a remote file.
+func sameContent(fs RemoteFS, hasher checksum.Hasher, localFilePath, remoteFilePath string) (bool, error) {
+	localFile, err := os.Open(localFilePath)
+	if err != nil {
+		return false, err
+	}
+	defer localFile.Close()
+
+	localHash := hasher.New()
+	if _, err := io.Copy(localHash, localFile); err != nil {
+		return false, fmt.Errorf("could not hash local file: %w", err)
+	}
+
+	remoteFile, err := fs.Open(remoteFilePath)
+	if err != nil {
+		return false, err
+	}
+	defer remoteFile.Close()
+
+	remoteHash := hasher.New()
+	if _, err := io.Copy(remoteHash, remoteFile); err != nil {
+		return false, fmt.Errorf("could not hash remote file: %w", err)
+	}
+
+	logger.Sugar.Debugf("Hash %s local %x, remoto %x", hasher.Name(), localHash.Sum(nil), remoteHash.Sum(nil))
+	return bytes.Equal(localHash.Sum(nil), remoteHash.Sum(nil)), nil
+}
@@ -0,0 +1,134 @@
+package smb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/config"
+)
+
+func TestSyncFiles_IncrementalSkipsUnchanged(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "alpha", "b.bak": "beta"})
+
+	fs := &countingFS{RemoteFS: NewMemFS()}
+	cfg := &config.Config{Path: localDir, SharedPath: ".", Incremental: true, CompareMode: config.CompareMTime}
+	files := []string{"a.bak", "b.bak"}
+
+	if err := syncFiles(context.Background(), fs, cfg, files); err != nil {
+		t.Fatalf("first run failed: %v", err)
+	}
+	firstRun := fs.written
+
+	if err := syncFiles(context.Background(), fs, cfg, files); err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+	if fs.written != firstRun {
+		t.Errorf("Expected unchanged files to be skipped, %d extra bytes written", fs.written-firstRun)
+	}
+
+	// Changing a file's size forces a new copy.
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "alpha v2"})
+	if err := syncFiles(context.Background(), fs, cfg, files); err != nil {
+		t.Fatalf("third run failed: %v", err)
+	}
+	if fs.written != firstRun+int64(len("alpha v2")) {
+		t.Errorf("Expected only the modified file to be copied, wrote %d bytes", fs.written-firstRun)
+	}
+	if got := readRemoteFile(t, fs, "a.bak"); got != "alpha v2" {
+		t.Errorf("Expected updated remote content, got %q", got)
+	}
+}
+
+func TestSyncFiles_IncrementalDetectsNewerMTime(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "alpha"})
+
+	fs := &countingFS{RemoteFS: NewMemFS()}
+	cfg := &config.Config{Path: localDir, SharedPath: ".", Incremental: true}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"}); err != nil {
+		t.Fatalf("first run failed: %v", err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(localDir, "a.bak"), later, later); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	before := fs.written
+	if err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"}); err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+	if fs.written == before {
+		t.Error("Expected a file with a newer modification time to be copied again")
+	}
+}
+
+func TestSyncFiles_IncrementalHashMode(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"same.bak": "identical", "diff.bak": "local v2"})
+
+	fs := &countingFS{RemoteFS: NewMemFS()}
+	writeRemoteFile(t, fs.RemoteFS, "same.bak", "identical")
+	writeRemoteFile(t, fs.RemoteFS, "diff.bak", "remote 1")
+
+	cfg := &config.Config{
+		Path:        localDir,
+		SharedPath:  ".",
+		Incremental: true,
+		CompareMode: config.CompareHash,
+		DeleteAfter: true,
+	}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"same.bak", "diff.bak"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+
+	if fs.written != int64(len("local v2")) {
+		t.Errorf("Expected only diff.bak to be copied, wrote %d bytes", fs.written)
+	}
+	if got := readRemoteFile(t, fs, "diff.bak"); got != "local v2" {
+		t.Errorf("Expected diff.bak to be replaced, got %q", got)
+	}
+	// A hash-verified skip is as good as a verified copy, so --delete applies.
+	if _, err := os.Stat(filepath.Join(localDir, "same.bak")); !os.IsNotExist(err) {
+		t.Error("Expected hash-verified unchanged file to be deleted locally")
+	}
+}
+
+func TestSyncFiles_IncrementalMTimeKeepsLocalFile(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "alpha"})
+	info, _ := os.Stat(filepath.Join(localDir, "a.bak"))
+
+	fs := NewMemFS()
+	writeRemoteFile(t, fs, "a.bak", "alpha")
+	fs.Chtimes("a.bak", info.ModTime(), info.ModTime())
+
+	cfg := &config.Config{Path: localDir, SharedPath: ".", Incremental: true, DeleteAfter: true}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(localDir, "a.bak")); err != nil {
+		t.Errorf("Local file must be kept when the skip was not verified by hash: %v", err)
+	}
+}
+
+func TestSyncFiles_IncrementalZip(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"report.csv": "a,b\n"})
+
+	fs := &countingFS{RemoteFS: NewMemFS()}
+	cfg := &config.Config{Path: localDir, SharedPath: ".", Zippy: true, Incremental: true}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"report.csv"}); err != nil {
+		t.Fatalf("first run failed: %v", err)
+	}
+	before := fs.written
+	if err := syncFiles(context.Background(), fs, cfg, []string{"report.csv"}); err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+	if fs.written != before {
+		t.Error("Expected the compressed copy to be skipped when the source is unchanged")
+	}
+}
@@ -0,0 +1,72 @@
+package smb
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type localFS struct {
+	root string
+}
+
+// NewLocalFS returns a RemoteFS backed by a local directory, which allows a
+// plain path (or a mounted network drive) to be used as the sync target.
+func NewLocalFS(root string) RemoteFS {
+	return &localFS{root: root}
+}
+
+func (l *localFS) path(name string) string {
+	return filepath.Join(l.root, filepath.FromSlash(name))
+}
+
+func (l *localFS) Create(name string) (RemoteFile, error) {
+	return os.Create(l.path(name))
+}
+
+func (l *localFS) Open(name string) (RemoteFile, error) {
+	return os.Open(l.path(name))
+}
+
+func (l *localFS) OpenFile(name string, flag int, perm os.FileMode) (RemoteFile, error) {
+	return os.OpenFile(l.path(name), flag, perm)
+}
+
+func (l *localFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(l.path(name))
+}
+
+func (l *localFS) MkdirAll(name string, perm os.FileMode) error {
+	return os.MkdirAll(l.path(name), perm)
+}
+
+func (l *localFS) Rename(oldname, newname string) error {
+	return os.Rename(l.path(oldname), l.path(newname))
+}
+
+func (l *localFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(l.path(name), atime, mtime)
+}
+
+func (l *localFS) Remove(name string) error {
+	return os.Remove(l.path(name))
+}
+
+func (l *localFS) ReadDir(name string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(l.path(name))
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package smb
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// isLocked reports whether another process still has path open for writing.
+// Opening it without sharing write access fails with a sharing violation
+// while the writer keeps its handle.
+func isLocked(path string) bool {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return false
+	}
+	h, err := windows.CreateFile(name, windows.GENERIC_READ, windows.FILE_SHARE_READ, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+	}
+	windows.CloseHandle(h)
+	return false
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package smb
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// isLocked reports whether another process holds an exclusive or shared
+// flock on path. Writers that do not lock are caught by the stability window.
+func isLocked(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return true
+	}
+	if err == nil {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	}
+	return false
+}
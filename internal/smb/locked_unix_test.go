@@ -0,0 +1,42 @@
+//go:build !windows
+
+package smb
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/config"
+)
+
+func TestWatcher_WaitsForLockedFile(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"data.bak": "payload"})
+	w := newTestWatcher(&config.Config{Regex: `\.bak$`, Path: localDir, StableFor: time.Second})
+
+	f, err := os.Open(filepath.Join(localDir, "data.bak"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+
+	w.track("data.bak")
+	w.dispatchStable(time.Now().Add(time.Minute))
+	if len(w.ready) != 0 {
+		t.Fatal("Expected a locked file to wait")
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_UN); err != nil {
+		t.Fatal(err)
+	}
+	w.dispatchStable(time.Now().Add(2 * time.Minute))
+	if len(w.ready) != 1 {
+		t.Error("Expected the file to be ready once unlocked")
+	}
+}
@@ -0,0 +1,282 @@
+package smb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hvarillas/smbsync/internal/checksum"
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+)
+
+// manifestEntry is the recorded hash of one file.
+type manifestEntry struct {
+	algorithm string
+	hash      []byte
+}
+
+var (
+	// bsdLine matches the BSD tag format written by smbsync and by
+	// sha256sum --tag: "SHA256 (name) = hash".
+	bsdLine = regexp.MustCompile(`^([A-Za-z0-9-]+) \((.+)\) = ([0-9a-fA-F]+)$`)
+	// gnuLine matches the default sha256sum format: "hash  name".
+	gnuLine = regexp.MustCompile(`^([0-9a-fA-F]{8,}) [ *](.+)$`)
+)
+
+// sidecarSuffix is appended to a file name to get its sidecar manifest, e.g.
+// ".sha256".
+func sidecarSuffix(algorithm string) string {
+	return "." + strings.ToLower(algorithm)
+}
+
+// dirManifestName is the manifest that lists the files of a directory, e.g.
+// SHA256SUMS.
+func dirManifestName(algorithm string) string {
+	return strings.ToUpper(algorithm) + "SUMS"
+}
+
+// parseManifest reads the entries of a manifest, keyed by file name relative
+// to the manifest's directory. Lines without an algorithm tag are taken to be
+// of algorithm.
+func parseManifest(r io.Reader, algorithm string) (map[string]manifestEntry, error) {
+	entries := map[string]manifestEntry{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var name, tag, sum string
+		if m := bsdLine.FindStringSubmatch(line); m != nil {
+			tag, name, sum = strings.ToUpper(m[1]), m[2], m[3]
+		} else if m := gnuLine.FindStringSubmatch(line); m != nil {
+			tag, name, sum = strings.ToUpper(algorithm), m[2], m[1]
+		} else {
+			return nil, fmt.Errorf("line %d: unrecognized manifest entry", n)
+		}
+
+		hash, err := hex.DecodeString(sum)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		entries[name] = manifestEntry{algorithm: tag, hash: hash}
+	}
+	return entries, scanner.Err()
+}
+
+// formatManifest writes entries sorted by name in the BSD tag format, which
+// sha256sum -c also accepts.
+func formatManifest(entries map[string]manifestEntry) []byte {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s (%s) = %x\n", entries[name].algorithm, name, entries[name].hash)
+	}
+	return buf.Bytes()
+}
+
+// manifestKind tells whether name is a manifest of any supported algorithm,
+// which algorithm and whether it is a sidecar or a directory manifest.
+func manifestKind(name string) (algorithm string, sidecar, ok bool) {
+	base := path.Base(filepath.ToSlash(name))
+	for _, algorithm := range checksum.Names() {
+		if base == dirManifestName(algorithm) {
+			return algorithm, false, true
+		}
+		suffix := sidecarSuffix(algorithm)
+		if len(base) > len(suffix) && strings.EqualFold(base[len(base)-len(suffix):], suffix) {
+			return algorithm, true, true
+		}
+	}
+	return "", false, false
+}
+
+// isManifest reports whether remotePath is a manifest. The name alone is not
+// enough, since a share may hold other .sha256 or SHA256SUMS files: a sidecar
+// is a manifest when the file it is named after exists or, once that file is
+// gone, when it still describes only that file; a directory manifest when it
+// reads as one. A file that cannot be opened is taken to be a manifest, so it
+// is neither downloaded nor pruned.
+func isManifest(fs RemoteFS, remotePath string) bool {
+	algorithm, sidecar, ok := manifestKind(remotePath)
+	if !ok {
+		return false
+	}
+	var described string
+	if sidecar {
+		described = remotePath[:len(remotePath)-len(sidecarSuffix(algorithm))]
+		if _, err := fs.Stat(described); err == nil {
+			return true
+		}
+	}
+
+	f, err := fs.Open(remotePath)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+	entries, err := parseManifest(f, algorithm)
+	if err != nil || len(entries) == 0 {
+		return false
+	}
+	if sidecar {
+		_, ok := entries[filepath.Base(described)]
+		return ok && len(entries) == 1
+	}
+	return true
+}
+
+// manifestPath returns the manifest of algorithm that holds the entry of
+// remotePath, and the name of the entry in it.
+func manifestPath(mode, algorithm, remotePath string) (manifest, entry string) {
+	if mode == config.ManifestDir {
+		return filepath.Join(filepath.Dir(remotePath), dirManifestName(algorithm)), filepath.Base(remotePath)
+	}
+	return remotePath + sidecarSuffix(algorithm), filepath.Base(remotePath)
+}
+
+// recordManifest stores hash as the manifest entry of remotePath, when
+// manifests are enabled. The manifest is the one of the job's algorithm.
+// Directory manifests are shared by every file of a directory, so their
+// entries are kept until flushManifests writes each of them once.
+func (j *syncJob) recordManifest(remotePath string, hash []byte) {
+	if j.cfg.Manifest == "" {
+		return
+	}
+	manifest, name := manifestPath(j.cfg.Manifest, j.hasher.Name(), remotePath)
+	entry := manifestEntry{algorithm: j.hasher.Name(), hash: hash}
+	if j.cfg.Manifest == config.ManifestDir {
+		j.manifestMu.Lock()
+		defer j.manifestMu.Unlock()
+		if j.pendingManifests == nil {
+			j.pendingManifests = map[string]map[string]manifestEntry{}
+		}
+		if j.pendingManifests[manifest] == nil {
+			j.pendingManifests[manifest] = map[string]manifestEntry{}
+		}
+		j.pendingManifests[manifest][name] = entry
+		return
+	}
+	err := j.updateManifest(manifest, func(entries map[string]manifestEntry) {
+		entries[name] = entry
+	})
+	if err != nil {
+		logger.Sugar.Warnf("No se pudo actualizar el manifiesto de %s: %v", remotePath, err)
+	}
+}
+
+// flushManifests writes the directory manifest entries recorded since the
+// last flush, reading and writing each manifest once.
+func (j *syncJob) flushManifests() {
+	j.manifestMu.Lock()
+	pending := j.pendingManifests
+	j.pendingManifests = nil
+	j.manifestMu.Unlock()
+
+	for _, manifest := range slices.Sorted(maps.Keys(pending)) {
+		err := j.updateManifest(manifest, func(entries map[string]manifestEntry) {
+			maps.Copy(entries, pending[manifest])
+		})
+		if err != nil {
+			logger.Sugar.Warnf("No se pudo actualizar el manifiesto %s: %v", manifest, err)
+		}
+	}
+}
+
+// forgetManifest removes the entry of a deleted remote file from whichever
+// manifest holds it, even if manifests are no longer enabled or were written
+// with another algorithm.
+func (j *syncJob) forgetManifest(remotePath string) {
+	for _, mode := range []string{config.ManifestSidecar, config.ManifestDir} {
+		for _, algorithm := range checksum.Names() {
+			manifest, name := manifestPath(mode, algorithm, remotePath)
+			err := j.updateManifest(manifest, func(entries map[string]manifestEntry) {
+				delete(entries, name)
+			})
+			if err != nil {
+				logger.Sugar.Warnf("No se pudo actualizar el manifiesto %s: %v", manifest, err)
+			}
+		}
+	}
+}
+
+// updateManifest applies change to the entries of manifest and writes it
+// back, or removes it once it has no entries.
+func (j *syncJob) updateManifest(manifest string, change func(entries map[string]manifestEntry)) error {
+	// Directory manifests are shared by the files of a directory.
+	j.manifestMu.Lock()
+	defer j.manifestMu.Unlock()
+
+	entries, err := readManifest(j.fs, manifest)
+	existed := err == nil
+	if errors.Is(err, os.ErrNotExist) {
+		entries = map[string]manifestEntry{}
+	} else if err != nil {
+		return err
+	}
+
+	change(entries)
+	if len(entries) == 0 {
+		if !existed {
+			return nil
+		}
+		if err := j.fs.Remove(manifest); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return writeRemoteAtomic(j.fs, manifest, formatManifest(entries))
+}
+
+func readManifest(fs RemoteFS, name string) (map[string]manifestEntry, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	algorithm, _, _ := manifestKind(name)
+	entries, err := parseManifest(f, algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return entries, nil
+}
+
+// writeRemoteAtomic writes data to a temporary name and moves it over name,
+// so a reader never sees a half written file.
+func writeRemoteAtomic(fs RemoteFS, name string, data []byte) error {
+	tmp := partPath(name)
+	f, err := fs.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		fs.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		fs.Remove(tmp)
+		return err
+	}
+	return fs.Rename(tmp, name)
+}
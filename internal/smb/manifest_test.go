@@ -0,0 +1,292 @@
+package smb
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hvarillas/smbsync/internal/checksum"
+	"github.com/hvarillas/smbsync/internal/config"
+)
+
+func hashHex(algorithm, content string) string {
+	hasher, err := checksum.Get(algorithm)
+	if err != nil {
+		panic(err)
+	}
+	h := hasher.New()
+	h.Write([]byte(content))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func sha256Hex(content string) string {
+	return hashHex(checksum.SHA256, content)
+}
+
+func TestParseManifest(t *testing.T) {
+	sum := sha256Hex("backup")
+
+	testCases := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{"bsd", "SHA256 (db.bak) = " + sum + "\n", "db.bak", false},
+		{"gnu", sum + "  db.bak\n", "db.bak", false},
+		{"gnu binary", sum + " *db 1.bak\n", "db 1.bak", false},
+		{"comments", "# written by hand\n\nSHA256 (db.bak) = " + sum + "\n", "db.bak", false},
+		{"garbage", "not a manifest\n", "", true},
+		{"bad hash", "SHA256 (db.bak) = abc\n", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := parseManifest(strings.NewReader(tc.content), checksum.SHA256)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseManifest failed: %v", err)
+			}
+			entry, ok := entries[tc.want]
+			if !ok || entry.algorithm != "SHA256" || hex.EncodeToString(entry.hash) != sum {
+				t.Errorf("Expected a SHA256 entry for %s, got %v", tc.want, entries)
+			}
+		})
+	}
+}
+
+func TestFormatManifest_RoundTrip(t *testing.T) {
+	a, _ := hex.DecodeString(sha256Hex("a"))
+	b, _ := hex.DecodeString(sha256Hex("b"))
+	entries := map[string]manifestEntry{
+		"b.bak": {algorithm: "SHA256", hash: b},
+		"a.bak": {algorithm: "SHA256", hash: a},
+	}
+
+	data := formatManifest(entries)
+	if want := "SHA256 (a.bak) = " + sha256Hex("a") + "\n"; !strings.HasPrefix(string(data), want) {
+		t.Errorf("Expected entries sorted in BSD format, got %q", data)
+	}
+	parsed, err := parseManifest(bytes.NewReader(data), checksum.SHA256)
+	if err != nil {
+		t.Fatalf("parseManifest failed: %v", err)
+	}
+	if len(parsed) != 2 || !bytes.Equal(parsed["b.bak"].hash, b) {
+		t.Errorf("Expected the entries back, got %v", parsed)
+	}
+}
+
+func TestSyncFiles_Manifest(t *testing.T) {
+	testCases := []struct {
+		mode string
+		hash string
+		// manifests maps each manifest to the entries it must hold.
+		manifests map[string][]string
+	}{
+		{config.ManifestSidecar, "", map[string][]string{
+			"sql/db1.bak.sha256": {"SHA256 (db1.bak) = " + sha256Hex("first")},
+			"sql/db2.bak.sha256": {"SHA256 (db2.bak) = " + sha256Hex("second")},
+		}},
+		{config.ManifestDir, "", map[string][]string{
+			"sql/SHA256SUMS": {
+				"SHA256 (db1.bak) = " + sha256Hex("first"),
+				"SHA256 (db2.bak) = " + sha256Hex("second"),
+			},
+		}},
+		{config.ManifestDir, checksum.BLAKE3, map[string][]string{
+			"sql/BLAKE3SUMS": {
+				"BLAKE3 (db1.bak) = " + hashHex(checksum.BLAKE3, "first"),
+				"BLAKE3 (db2.bak) = " + hashHex(checksum.BLAKE3, "second"),
+			},
+		}},
+		{config.ManifestSidecar, checksum.CRC32C, map[string][]string{
+			"sql/db1.bak.crc32c": {"CRC32C (db1.bak) = " + hashHex(checksum.CRC32C, "first")},
+			"sql/db2.bak.crc32c": {"CRC32C (db2.bak) = " + hashHex(checksum.CRC32C, "second")},
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.mode+" "+tc.hash, func(t *testing.T) {
+			localDir := t.TempDir()
+			writeTestFiles(t, localDir, map[string]string{"db1.bak": "first", "db2.bak": "second"})
+			fs := NewMemFS()
+			cfg := &config.Config{Path: localDir, SharedPath: "sql", Manifest: tc.mode, Hash: tc.hash, Concurrency: 2}
+
+			if err := syncFiles(context.Background(), fs, cfg, []string{"db1.bak", "db2.bak"}); err != nil {
+				t.Fatalf("syncFiles failed: %v", err)
+			}
+			for manifest, lines := range tc.manifests {
+				if got, want := readRemoteFile(t, fs, manifest), strings.Join(lines, "\n")+"\n"; got != want {
+					t.Errorf("Expected %s to be %q, got %q", manifest, want, got)
+				}
+			}
+		})
+	}
+}
+
+// manifestWritesFS counts the directory manifests moved into place.
+type manifestWritesFS struct {
+	RemoteFS
+	writes int
+}
+
+func (m *manifestWritesFS) Rename(oldname, newname string) error {
+	if filepath.Base(newname) == "SHA256SUMS" {
+		m.writes++
+	}
+	return m.RemoteFS.Rename(oldname, newname)
+}
+
+func TestSyncFiles_DirManifestWrittenOnce(t *testing.T) {
+	localDir := t.TempDir()
+	files := map[string]string{}
+	var names []string
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("db%d.bak", i)
+		files[name] = name
+		names = append(names, name)
+	}
+	writeTestFiles(t, localDir, files)
+	fs := &manifestWritesFS{RemoteFS: NewMemFS()}
+	cfg := &config.Config{Path: localDir, SharedPath: "sql", Manifest: config.ManifestDir}
+
+	if err := syncFiles(context.Background(), fs, cfg, names); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+	if fs.writes != 1 {
+		t.Errorf("Expected SHA256SUMS to be written once, got %d writes", fs.writes)
+	}
+	entries, err := readManifest(fs, "sql/SHA256SUMS")
+	if err != nil || len(entries) != len(names) {
+		t.Errorf("Expected %d entries, got %v (%v)", len(names), entries, err)
+	}
+}
+
+func TestIsManifest(t *testing.T) {
+	fs := newRemoteTree(t, map[string]string{
+		"db.bak":            "backup",
+		"db.bak.sha256":     "SHA256 (db.bak) = " + sha256Hex("backup") + "\n",
+		"gone.bak.sha256":   "SHA256 (gone.bak) = " + sha256Hex("gone") + "\n",
+		"release.sha256":    sha256Hex("release") + "  release.tar.gz\n",
+		"notes.sha256":      "not a checksum",
+		"SHA256SUMS":        sha256Hex("backup") + "  db.bak\n",
+		"sub/SHA512SUMS":    "release notes",
+		"sub/readme.blake3": "",
+	})
+
+	for name, want := range map[string]bool{
+		"db.bak":            false,
+		"db.bak.sha256":     true,
+		"gone.bak.sha256":   true,
+		"release.sha256":    false,
+		"notes.sha256":      false,
+		"SHA256SUMS":        true,
+		"sub/SHA512SUMS":    false,
+		"sub/readme.blake3": false,
+	} {
+		if got := isManifest(fs, name); got != want {
+			t.Errorf("Expected isManifest(%s) = %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestPruneRemote_ForgetsManifestEntries(t *testing.T) {
+	fs := NewMemFS()
+	backups := remoteBackups(t, fs, "sql", 3)
+	job := newSyncJob(context.Background(), fs, &config.Config{Manifest: config.ManifestDir}, "push")
+	for _, name := range backups {
+		job.recordManifest(name, []byte{1})
+	}
+	job.flushManifests()
+	cfg := &config.Config{Regex: `\.bak$`, SharedPath: "sql", KeepLast: 1}
+
+	if err := pruneRemote(fs, cfg, false); err != nil {
+		t.Fatalf("pruneRemote failed: %v", err)
+	}
+	entries, err := readManifest(fs, "sql/SHA256SUMS")
+	if err != nil {
+		t.Fatalf("readManifest failed: %v", err)
+	}
+	if _, ok := entries[filepath.Base(backups[0])]; len(entries) != 1 || !ok {
+		t.Errorf("Expected only %s in the manifest, got %v", backups[0], entries)
+	}
+}
+
+func TestVerifyRemote(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{
+		"ok.bak":      "intact",
+		"changed.bak": "original",
+		"missing.bak": "gone",
+	})
+	fs := NewMemFS()
+	cfg := &config.Config{Regex: `\.bak$`, Path: localDir, SharedPath: ".", Manifest: config.ManifestSidecar}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"ok.bak", "changed.bak", "missing.bak"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+
+	if err := verifyRemote(context.Background(), fs, cfg); err != nil {
+		t.Fatalf("Expected a fresh copy to verify, got %v", err)
+	}
+
+	writeRemoteFile(t, fs, "changed.bak", "tampered")
+	if err := fs.Remove("missing.bak"); err != nil {
+		t.Fatal(err)
+	}
+	writeRemoteFile(t, fs, "extra.bak", "unknown")
+	writeRemoteFile(t, fs, "notes.txt", "outside the regex")
+
+	err := verifyRemote(context.Background(), fs, cfg)
+	if !errors.Is(err, ErrMismatch) {
+		t.Fatalf("Expected ErrMismatch, got %v", err)
+	}
+	if want := "1 changed, 1 missing, 1 without manifest"; !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected %q in the error, got %v", want, err)
+	}
+}
+
+func TestVerifyRemote_UsesRecordedAlgorithm(t *testing.T) {
+	fs := newRemoteTree(t, map[string]string{
+		"a.bak":        "alpha",
+		"b.bak":        "beta",
+		"XXH3SUMS":     hashHex(checksum.XXH3, "alpha") + "  a.bak\n",
+		"b.bak.sha512": "SHA512 (b.bak) = " + hashHex(checksum.SHA512, "beta") + "\n",
+	})
+	// The configured algorithm only applies to new copies.
+	cfg := &config.Config{Regex: `\.bak$`, SharedPath: ".", Hash: checksum.CRC32C}
+
+	if err := verifyRemote(context.Background(), fs, cfg); err != nil {
+		t.Fatalf("verifyRemote failed: %v", err)
+	}
+}
+
+func TestRunVerify_LocalTarget(t *testing.T) {
+	targetDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(targetDir, "sql"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"sql/db.bak":     "backup",
+		"sql/SHA256SUMS": sha256Hex("backup") + "  db.bak\n",
+	} {
+		if err := os.WriteFile(filepath.Join(targetDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &config.Config{Regex: `\.bak$`, SharedPath: ".", TargetDir: targetDir, Recursive: true}
+	if err := RunVerify(context.Background(), cfg); err != nil {
+		t.Fatalf("RunVerify failed: %v", err)
+	}
+}
@@ -0,0 +1,337 @@
+package smb
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memFS is an in-memory RemoteFS used by tests to run the whole sync pipeline
+// without an SMB server.
+type memFS struct {
+	mu    sync.Mutex
+	nodes map[string]*memNode
+}
+
+type memNode struct {
+	dir     bool
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemFS returns an empty in-memory RemoteFS.
+func NewMemFS() RemoteFS {
+	return &memFS{nodes: map[string]*memNode{
+		".": {dir: true, modTime: time.Now()},
+	}}
+}
+
+func memPath(name string) string {
+	return path.Clean(strings.TrimPrefix(filepath.ToSlash(name), "/"))
+}
+
+func memErr(op, name string, err error) error {
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+func (m *memFS) Create(name string) (RemoteFile, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+func (m *memFS) Open(name string) (RemoteFile, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *memFS) OpenFile(name string, flag int, perm os.FileMode) (RemoteFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := memPath(name)
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	node, ok := m.nodes[p]
+	switch {
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, memErr("open", name, os.ErrNotExist)
+	case !ok:
+		if parent, ok := m.nodes[path.Dir(p)]; !ok || !parent.dir {
+			return nil, memErr("open", name, os.ErrNotExist)
+		}
+		node = &memNode{modTime: time.Now()}
+		m.nodes[p] = node
+	case node.dir && writable:
+		return nil, memErr("open", name, errors.New("is a directory"))
+	case flag&os.O_TRUNC != 0 && writable:
+		node.data = nil
+		node.modTime = time.Now()
+	}
+	return &memFile{fs: m, name: p, node: node, writable: writable}, nil
+}
+
+func (m *memFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := memPath(name)
+	node, ok := m.nodes[p]
+	if !ok {
+		return nil, memErr("stat", name, os.ErrNotExist)
+	}
+	return node.info(p), nil
+}
+
+func (m *memFS) MkdirAll(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := memPath(name)
+	var dirs []string
+	for ; p != "." && p != "/"; p = path.Dir(p) {
+		dirs = append(dirs, p)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		node, ok := m.nodes[dirs[i]]
+		if !ok {
+			m.nodes[dirs[i]] = &memNode{dir: true, modTime: time.Now()}
+			continue
+		}
+		if !node.dir {
+			return memErr("mkdir", dirs[i], errors.New("not a directory"))
+		}
+	}
+	return nil
+}
+
+func (m *memFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldp, newp := memPath(oldname), memPath(newname)
+	node, ok := m.nodes[oldp]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	if node.dir {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errors.New("renaming directories is not supported")}
+	}
+	if parent, ok := m.nodes[path.Dir(newp)]; !ok || !parent.dir {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	delete(m.nodes, oldp)
+	m.nodes[newp] = node
+	return nil
+}
+
+func (m *memFS) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.nodes[memPath(name)]
+	if !ok {
+		return memErr("chtimes", name, os.ErrNotExist)
+	}
+	node.modTime = mtime
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := memPath(name)
+	node, ok := m.nodes[p]
+	if !ok || p == "." {
+		return memErr("remove", name, os.ErrNotExist)
+	}
+	if node.dir && len(m.children(p)) > 0 {
+		return memErr("remove", name, errors.New("directory not empty"))
+	}
+	delete(m.nodes, p)
+	return nil
+}
+
+func (m *memFS) ReadDir(name string) ([]os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := memPath(name)
+	node, ok := m.nodes[p]
+	if !ok {
+		return nil, memErr("readdir", name, os.ErrNotExist)
+	}
+	if !node.dir {
+		return nil, memErr("readdir", name, errors.New("not a directory"))
+	}
+
+	children := m.children(p)
+	infos := make([]os.FileInfo, 0, len(children))
+	for _, child := range children {
+		infos = append(infos, m.nodes[child].info(child))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (m *memFS) children(dir string) []string {
+	var children []string
+	for p := range m.nodes {
+		if p != dir && path.Dir(p) == dir {
+			children = append(children, p)
+		}
+	}
+	return children
+}
+
+func (n *memNode) info(p string) os.FileInfo {
+	return &memFileInfo{
+		name:    path.Base(p),
+		size:    int64(len(n.data)),
+		modTime: n.modTime,
+		dir:     n.dir,
+	}
+}
+
+type memFile struct {
+	fs       *memFS
+	name     string
+	node     *memNode
+	offset   int64
+	writable bool
+	closed   bool
+}
+
+func (f *memFile) Read(b []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("read"); err != nil {
+		return 0, err
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) ReadAt(b []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("read"); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, memErr("read", f.name, errors.New("negative offset"))
+	}
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.node.data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(b []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("write"); err != nil {
+		return 0, err
+	}
+	if !f.writable {
+		return 0, memErr("write", f.name, os.ErrPermission)
+	}
+	end := f.offset + int64(len(b))
+	if end > int64(len(f.node.data)) {
+		grown := make([]byte, end)
+		copy(grown, f.node.data)
+		f.node.data = grown
+	}
+	copy(f.node.data[f.offset:], b)
+	f.offset = end
+	f.node.modTime = time.Now()
+	return len(b), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("seek"); err != nil {
+		return 0, err
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	default:
+		return 0, memErr("seek", f.name, errors.New("invalid whence"))
+	}
+	if offset < 0 {
+		return 0, memErr("seek", f.name, errors.New("negative offset"))
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("close"); err != nil {
+		return err
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("stat"); err != nil {
+		return nil, err
+	}
+	return f.node.info(f.name), nil
+}
+
+func (f *memFile) check(op string) error {
+	if f.closed {
+		return memErr(op, f.name, os.ErrClosed)
+	}
+	if f.node.dir && op != "close" && op != "stat" {
+		return memErr(op, f.name, errors.New("is a directory"))
+	}
+	return nil
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return i.size }
+func (i *memFileInfo) ModTime() time.Time { return i.modTime }
+func (i *memFileInfo) IsDir() bool        { return i.dir }
+func (i *memFileInfo) Sys() interface{}   { return nil }
+
+func (i *memFileInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
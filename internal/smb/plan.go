@@ -0,0 +1,107 @@
+package smb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/logger"
+)
+
+// planAction is what a run does with a selected file.
+type planAction string
+
+const (
+	actionCopy          planAction = "copy"
+	actionOverwrite     planAction = "overwrite"
+	actionRename        planAction = "rename"
+	actionSkipUnchanged planAction = "skip-unchanged"
+	actionSkipExisting  planAction = "skip-existing"
+	actionFail          planAction = "fail"
+)
+
+// filePlan is the decision taken for one file before anything is written. It
+// is shared by real runs and dry runs so both follow the same rules.
+type filePlan struct {
+	file       string
+	localPath  string
+	remotePath string
+	// target is where the file is written; it differs from remotePath when
+	// the conflict policy renames the copy.
+	target     string
+	action     planAction
+	sourceInfo os.FileInfo
+	// verified is set when an unchanged file was compared by hash.
+	verified bool
+	// checked is false when the destination was not consulted (offline
+	// dry run), in which case the file is planned as a plain copy.
+	checked bool
+}
+
+// deletesLocal reports whether --delete removes the local file under this plan.
+func (p filePlan) deletesLocal(deleteAfter bool) bool {
+	if !deleteAfter {
+		return false
+	}
+	switch p.action {
+	case actionCopy, actionOverwrite, actionRename:
+		return true
+	case actionSkipUnchanged:
+		return p.verified
+	}
+	return false
+}
+
+// planFile decides what to do with fileName. It only reads from the local
+// disk and the destination; job.fs may be nil to plan without connecting.
+func planFile(job *syncJob, fileName string) (filePlan, error) {
+	plan := filePlan{
+		file:       fileName,
+		localPath:  filepath.Join(job.cfg.Path, fileName),
+		remotePath: filepath.Join(job.cfg.SharedPath, remoteName(job, fileName)),
+		action:     actionCopy,
+	}
+	plan.target = plan.remotePath
+
+	sourceInfo, err := os.Stat(plan.localPath)
+	if err != nil {
+		logger.Sugar.Errorf("Error al obtener información del archivo local %s: %v", plan.localPath, err)
+		return plan, fmt.Errorf("could not stat local file %s: %w", plan.localPath, err)
+	}
+	plan.sourceInfo = sourceInfo
+
+	if job.fs == nil {
+		return plan, nil
+	}
+	plan.checked = true
+
+	if job.cfg.Incremental {
+		unchanged, verified := checkUnchanged(job, plan.localPath, sourceInfo, plan.remotePath)
+		if unchanged {
+			plan.action, plan.verified = actionSkipUnchanged, verified
+			return plan, nil
+		}
+	}
+
+	remoteInfo, err := job.fs.Stat(plan.remotePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return plan, nil
+	}
+	if err != nil {
+		logger.Sugar.Errorf("Error al consultar el archivo remoto %s: %v", plan.remotePath, err)
+		return plan, fmt.Errorf("could not stat remote file %s: %w", plan.remotePath, err)
+	}
+
+	plan.action = conflictAction(job.cfg.OnConflict, sourceInfo, remoteInfo)
+	if plan.action == actionRename {
+		target, err := freeRemoteName(job.fs, plan.remotePath, time.Now())
+		if err != nil {
+			logger.Sugar.Errorf("Error al buscar un nombre libre para %s: %v", plan.remotePath, err)
+			return plan, err
+		}
+		plan.target = target
+	}
+	return plan, nil
+}
@@ -0,0 +1,52 @@
+package smb
+
+import (
+	"io"
+	"time"
+
+	"github.com/k0kubun/go-ansi"
+	"github.com/schollz/progressbar/v3"
+)
+
+func newProgressBar(size int64, description string) *progressbar.ProgressBar {
+	return progressbar.NewOptions64(
+		size,
+		progressbar.OptionSetDescription(description),
+		progressbar.OptionSetWriter(ansi.NewAnsiStdout()),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionSetWidth(40),
+		progressbar.OptionThrottle(100*time.Millisecond),
+		progressbar.OptionShowCount(),
+		progressbar.OptionClearOnFinish(),
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "[green]█[reset]",
+			SaucerHead:    "[green]█[reset]",
+			SaucerPadding: "░",
+			BarStart:      "|",
+			BarEnd:        "|",
+		}),
+	)
+}
+
+// copyProgress returns the writer that tracks the upload of one file, already
+// advanced by offset bytes. In parallel runs every file reports to the shared
+// run bar, since per-file bars would overwrite each other.
+func (j *syncJob) copyProgress(size, offset int64) io.Writer {
+	if j.progress != nil {
+		j.progress.Add64(offset)
+		return j.progress
+	}
+	bar := newProgressBar(size, "Copiando...")
+	bar.Set64(offset)
+	return bar
+}
+
+// phaseProgress returns the writer for the secondary phases of a file
+// (compression, verification), which are only drawn in sequential runs.
+func (j *syncJob) phaseProgress(size int64, description string) io.Writer {
+	if j.progress != nil {
+		return io.Discard
+	}
+	return newProgressBar(size, description)
+}
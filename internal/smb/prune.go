@@ -0,0 +1,131 @@
+package smb
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+	"github.com/hvarillas/smbsync/internal/retention"
+)
+
+// pruneRemote applies the retention policy of cfg to the files under
+// cfg.SharedPath that match cfg.KeepRegex, or cfg.Regex when it is empty.
+// With dryRun it only logs what would be deleted.
+func pruneRemote(fs RemoteFS, cfg *config.Config, dryRun bool) error {
+	policy, err := cfg.RetentionPolicy()
+	if err != nil || !policy.Enabled() {
+		return err
+	}
+
+	prefix := "Retención:"
+	if dryRun {
+		prefix = "[simulación] Retención:"
+	}
+
+	listCfg := *cfg
+	if cfg.KeepRegex != "" {
+		listCfg.Regex = cfg.KeepRegex
+	} else if cfg.CompressFormat() != "" || cfg.Bundle != "" {
+		logger.Sugar.Warnf("%s con --compress o --bundle los archivos remotos están comprimidos; indica --keep-regex si --regex no los incluye", prefix)
+	}
+
+	var files []retention.File
+	for _, name := range getRemoteRegexFiles(fs, &listCfg) {
+		info, err := fs.Stat(filepath.Join(cfg.SharedPath, name))
+		if err != nil {
+			logger.Sugar.Warnf("%s no se pudo consultar %s, se conserva: %v", prefix, name, err)
+			continue
+		}
+		files = append(files, retention.File{Name: name, ModTime: info.ModTime()})
+	}
+
+	job := &syncJob{ctx: context.Background(), cfg: cfg, fs: fs}
+	keep, prune := policy.Plan(files, time.Now())
+	logger.Sugar.Infof("%s %d archivos remotos conservados, %d a eliminar", prefix, len(keep), len(prune))
+
+	failed := 0
+	for _, f := range prune {
+		modified := f.ModTime.Format(time.DateTime)
+		if dryRun {
+			logger.Sugar.Infof("%s se eliminaría %s (modificado %s)", prefix, f.Name, modified)
+			continue
+		}
+		remotePath := filepath.Join(cfg.SharedPath, f.Name)
+		if err := fs.Remove(remotePath); err != nil {
+			logger.Sugar.Errorf("%s no se pudo eliminar %s: %v", prefix, f.Name, err)
+			failed++
+			continue
+		}
+		job.forgetManifest(remotePath)
+		logger.Sugar.Infof("%s eliminado %s (modificado %s)", prefix, f.Name, modified)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("retention: %d of %d old files could not be deleted", failed, len(prune))
+	}
+	return nil
+}
+
+// pruneLocal deletes the local originals that the local retention policy no
+// longer keeps. Only files whose copy was verified by this job are deleted,
+// but the newest-N and age rules consider every file in files. It returns how
+// many deletions failed.
+func (j *syncJob) pruneLocal(files []string) int {
+	if !j.localKeep.Enabled() {
+		return 0
+	}
+	j.mu.Lock()
+	verified := maps.Clone(j.verifiedLocal)
+	j.mu.Unlock()
+	if len(verified) == 0 {
+		return 0
+	}
+
+	prune := localPrune(j.cfg.Path, j.localKeep, files, verified)
+	failed := 0
+	for _, file := range prune {
+		logger.Sugar.Infof("Retención local: %s ya no se conserva", file)
+		if err := removeLocal(j, file); err != nil {
+			failed++
+			continue
+		}
+		j.mu.Lock()
+		delete(j.verifiedLocal, file)
+		j.mu.Unlock()
+		if j.report != nil {
+			j.report.MarkDeleted(file)
+		}
+	}
+	logger.Sugar.Infof("Retención local: %d archivos verificados se conservan, %d eliminados", len(verified)-len(prune), len(prune)-failed)
+	return failed
+}
+
+// localPrune returns the files in verified that policy does not keep, applying
+// it to every file of files that still exists under base.
+func localPrune(base string, policy retention.Policy, files []string, verified map[string]bool) []string {
+	names := map[string]string{}
+	var local []retention.File
+	for _, file := range files {
+		info, err := os.Stat(filepath.Join(base, file))
+		if err != nil {
+			continue
+		}
+		name := filepath.ToSlash(file)
+		names[name] = file
+		local = append(local, retention.File{Name: name, ModTime: info.ModTime()})
+	}
+
+	_, prune := policy.Plan(local, time.Now())
+	var out []string
+	for _, f := range prune {
+		if file := names[f.Name]; verified[file] {
+			out = append(out, file)
+		}
+	}
+	return out
+}
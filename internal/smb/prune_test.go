@@ -0,0 +1,257 @@
+package smb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/config"
+)
+
+// remoteBackups creates one backup per day in fs, the newest today, and
+// returns their names newest first.
+func remoteBackups(t *testing.T, fs RemoteFS, dir string, days int) []string {
+	t.Helper()
+	if err := fs.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for i := 0; i < days; i++ {
+		modTime := time.Now().AddDate(0, 0, -i)
+		name := filepath.Join(dir, "db_"+modTime.Format("20060102")+".bak")
+		writeRemoteFile(t, fs, name, "backup")
+		if err := fs.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestPruneRemote(t *testing.T) {
+	fs := NewMemFS()
+	backups := remoteBackups(t, fs, "sql", 5)
+	writeRemoteFile(t, fs, "sql/notes.txt", "not a backup")
+	cfg := &config.Config{Regex: `\.bak$`, SharedPath: "sql", KeepLast: 2}
+
+	if err := pruneRemote(fs, cfg, true); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	for _, name := range backups {
+		if _, err := fs.Stat(name); err != nil {
+			t.Errorf("Expected dry run to keep %s: %v", name, err)
+		}
+	}
+
+	if err := pruneRemote(fs, cfg, false); err != nil {
+		t.Fatalf("pruneRemote failed: %v", err)
+	}
+	for i, name := range backups {
+		_, err := fs.Stat(name)
+		if i < 2 && err != nil {
+			t.Errorf("Expected %s to be kept: %v", name, err)
+		}
+		if i >= 2 && err == nil {
+			t.Errorf("Expected %s to be deleted", name)
+		}
+	}
+	if _, err := fs.Stat("sql/notes.txt"); err != nil {
+		t.Errorf("Files not matching the regex must not be deleted: %v", err)
+	}
+}
+
+func TestPruneRemote_KeepRegex(t *testing.T) {
+	fs := NewMemFS()
+	backups := remoteBackups(t, fs, ".", 3)
+	cfg := &config.Config{Regex: `\.txt$`, KeepRegex: `^db_`, SharedPath: ".", KeepWithin: "36h"}
+
+	if err := pruneRemote(fs, cfg, false); err != nil {
+		t.Fatalf("pruneRemote failed: %v", err)
+	}
+	if _, err := fs.Stat(backups[2]); err == nil {
+		t.Errorf("Expected %s to be deleted", backups[2])
+	}
+	if _, err := fs.Stat(backups[1]); err != nil {
+		t.Errorf("Expected %s to be kept: %v", backups[1], err)
+	}
+}
+
+func TestPruneRemote_NumberedHosts(t *testing.T) {
+	fs := NewMemFS()
+	var names []string
+	for _, host := range []string{"host01", "host02"} {
+		for i := 0; i < 3; i++ {
+			modTime := time.Now().AddDate(0, 0, -i)
+			name := host + "_" + modTime.Format("20060102") + ".bak"
+			writeRemoteFile(t, fs, name, "backup")
+			if err := fs.Chtimes(name, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, name)
+		}
+	}
+	cfg := &config.Config{Regex: `\.bak$`, SharedPath: ".", KeepLast: 1}
+
+	if err := pruneRemote(fs, cfg, false); err != nil {
+		t.Fatalf("pruneRemote failed: %v", err)
+	}
+	for i, name := range names {
+		_, err := fs.Stat(name)
+		if i%3 == 0 && err != nil {
+			t.Errorf("Expected the newest backup of each host, %s, to be kept: %v", name, err)
+		}
+		if i%3 != 0 && err == nil {
+			t.Errorf("Expected %s to be deleted", name)
+		}
+	}
+}
+
+func TestRunHeadless_RetentionAfterSync(t *testing.T) {
+	localDir := t.TempDir()
+	targetDir := t.TempDir()
+	// Same series as the remote backups, and newer than all of them.
+	latest := "db_29991231.bak"
+	writeTestFiles(t, localDir, map[string]string{latest: "new"})
+	old := remoteBackups(t, NewLocalFS(targetDir), ".", 3)
+
+	cfg := &config.Config{Regex: `\.bak$`, Path: localDir, SharedPath: ".", TargetDir: targetDir, KeepLast: 2}
+	if err := RunHeadless(cfg); err != nil {
+		t.Fatalf("RunHeadless failed: %v", err)
+	}
+
+	for _, name := range []string{latest, old[0]} {
+		if _, err := os.Stat(filepath.Join(targetDir, name)); err != nil {
+			t.Errorf("Expected %s to be kept: %v", name, err)
+		}
+	}
+	for _, name := range old[1:] {
+		if _, err := os.Stat(filepath.Join(targetDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be pruned, got %v", name, err)
+		}
+	}
+}
+
+func TestSyncFiles_FailureSkipsRetention(t *testing.T) {
+	localDir := t.TempDir()
+	targetDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"db_new.bak": "new"})
+	old := remoteBackups(t, NewLocalFS(targetDir), ".", 3)
+	// A directory in the way makes the upload fail.
+	if err := os.MkdirAll(filepath.Join(targetDir, "db_new.bak"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{Regex: `\.bak$`, Path: localDir, SharedPath: ".", TargetDir: targetDir, KeepLast: 1}
+	if err := RunHeadlessContext(context.Background(), cfg); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Expected ErrIncomplete, got %v", err)
+	}
+	for _, name := range old {
+		if _, err := os.Stat(filepath.Join(targetDir, name)); err != nil {
+			t.Errorf("Expected %s to be kept after a failed sync: %v", name, err)
+		}
+	}
+}
+
+// localBackups creates one local backup per day, the newest today, and
+// returns their names newest first.
+func localBackups(t *testing.T, dir string, days int) []string {
+	t.Helper()
+	var names []string
+	for i := 0; i < days; i++ {
+		modTime := time.Now().AddDate(0, 0, -i)
+		name := "db_" + modTime.Format("20060102") + ".bak"
+		writeTestFiles(t, dir, map[string]string{name: "backup " + name})
+		if err := os.Chtimes(filepath.Join(dir, name), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestSyncFiles_LocalRetention(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+		kept int
+	}{
+		{"keep last", config.Config{LocalKeepLast: 2}, 2},
+		{"keep within", config.Config{LocalKeepWithin: "60h"}, 3},
+		{"newest always kept", config.Config{LocalKeepWithin: "1h"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localDir := t.TempDir()
+			names := localBackups(t, localDir, 5)
+
+			fs := NewMemFS()
+			cfg := tt.cfg
+			cfg.Path, cfg.SharedPath, cfg.DeleteAfter = localDir, ".", true
+			cfg.Report = filepath.Join(t.TempDir(), "report.json")
+			if err := syncFiles(context.Background(), fs, &cfg, names); err != nil {
+				t.Fatalf("syncFiles failed: %v", err)
+			}
+
+			for i, name := range names {
+				if got := readRemoteFile(t, fs, name); got != "backup "+name {
+					t.Errorf("Expected %s on the share, got %q", name, got)
+				}
+				_, err := os.Stat(filepath.Join(localDir, name))
+				if i < tt.kept && err != nil {
+					t.Errorf("Expected local %s to be kept: %v", name, err)
+				}
+				if i >= tt.kept && !os.IsNotExist(err) {
+					t.Errorf("Expected local %s to be deleted, got %v", name, err)
+				}
+			}
+
+			if r := readReport(t, cfg.Report); r.Totals.Deleted != len(names)-tt.kept || r.Totals.Copied != tt.kept {
+				t.Errorf("Expected %d deleted and %d copied in the report, got %+v", len(names)-tt.kept, tt.kept, r.Totals)
+			}
+		})
+	}
+}
+
+func TestSyncFiles_LocalRetentionKeepsUnverified(t *testing.T) {
+	localDir := t.TempDir()
+	names := localBackups(t, localDir, 4)
+	oldest := names[3]
+
+	fs := &failingFS{RemoteFS: NewMemFS(), fail: func(name string) bool { return strings.Contains(name, oldest) }}
+	cfg := &config.Config{Path: localDir, SharedPath: ".", DeleteAfter: true, LocalKeepLast: 1}
+	if err := syncFiles(context.Background(), fs, cfg, names); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Expected ErrIncomplete, got %v", err)
+	}
+
+	for i, name := range names {
+		_, err := os.Stat(filepath.Join(localDir, name))
+		switch {
+		case i == 0 || name == oldest:
+			if err != nil {
+				t.Errorf("Expected local %s to be kept: %v", name, err)
+			}
+		case !os.IsNotExist(err):
+			t.Errorf("Expected local %s to be deleted, got %v", name, err)
+		}
+	}
+}
+
+func TestDryRun_LocalRetention(t *testing.T) {
+	localDir := t.TempDir()
+	names := localBackups(t, localDir, 3)
+
+	cfg := &config.Config{Path: localDir, SharedPath: ".", DeleteAfter: true, LocalKeepLast: 1}
+	if _, err := dryRun(NewMemFS(), cfg, names); err != nil {
+		t.Fatalf("dryRun failed: %v", err)
+	}
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(localDir, name)); err != nil {
+			t.Errorf("Expected dry run to keep %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package smb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+)
+
+// RunPull downloads the files under cfg.SharedPath that match cfg.Regex into
+// cfg.Path, verifies each local copy and optionally deletes the remote file.
+func RunPull(cfg *config.Config) error {
+	return RunPullContext(context.Background(), cfg)
+}
+
+// RunPullContext is RunPull for a run that can be stopped, with the same
+// semantics as RunHeadlessContext.
+func RunPullContext(ctx context.Context, cfg *config.Config) error {
+	logger.Sugar.Info("Iniciando descarga desde el recurso compartido.")
+	if cfg.CompressFormat() != "" {
+		logger.Sugar.Warn("La compresión no se aplica en modo pull; los archivos se descargan tal cual.")
+	}
+
+	fs, err := openSessionContext(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	files := getRemoteRegexFiles(fs, cfg)
+	if len(files) == 0 {
+		logger.Sugar.Warnf("No se encontraron archivos remotos que coincidan con el patrón en: %s", cfg.SharedPath)
+		return nil
+	}
+
+	logger.Sugar.Infof("Encontrados %d archivos para descargar", len(files))
+	return pullFiles(ctx, fs, cfg, files)
+}
+
+func pullFiles(ctx context.Context, fs RemoteFS, cfg *config.Config, files []string) error {
+	if cfg.DryRun {
+		return dryRunPull(fs, cfg, files)
+	}
+	job := newSyncJob(ctx, fs, cfg, "pull")
+
+	workers := workerCount(cfg.Concurrency, len(files))
+	if workers > 1 {
+		logger.Sugar.Infof("Descargando con %d transferencias en paralelo", workers)
+		job.progress = newProgressBar(remoteTotalSize(fs, cfg.SharedPath, files), fmt.Sprintf("Descargando (%d en paralelo)...", workers))
+	}
+
+	failed, notStarted := runPool(ctx, workers, files, func(file string) error {
+		start, t := time.Now(), &transfer{}
+		var outcome copyOutcome
+		err := job.withRetry(file, func() error {
+			*t = transfer{}
+			var err error
+			outcome, err = startDownload(job, file, t)
+			return err
+		})
+		job.record(file, t, outcome, err, time.Since(start))
+		if err != nil {
+			logger.Sugar.Errorf("Fallo al descargar %s: %v", file, err)
+			return err
+		}
+		if outcome == outcomeCopied {
+			logger.Sugar.Infof("Archivo %s descargado y verificado exitosamente.", file)
+		}
+		return nil
+	})
+
+	if job.progress != nil {
+		job.progress.Finish()
+	}
+	logger.Sugar.Info("Proceso de descarga completado.")
+	if notStarted > 0 {
+		logger.Sugar.Warnf("Descarga interrumpida: %d archivos sin procesar", notStarted)
+	}
+	job.writeReport()
+	return runResult(failed, notStarted, len(files))
+}
+
+// dryRunPull logs the download of every file, and the deletion of its remote
+// original with --delete, without writing locally or touching the share.
+func dryRunPull(fs RemoteFS, cfg *config.Config, files []string) error {
+	logger.Sugar.Info("[simulación] No se descargará nada ni se eliminarán archivos remotos")
+
+	var downloads, overwrites, renames, skips, deletes, failed int
+	for _, file := range files {
+		remoteFilePath := filepath.Join(cfg.SharedPath, file)
+		localFilePath := filepath.Join(cfg.Path, filepath.FromSlash(file))
+		info, err := fs.Stat(remoteFilePath)
+		if err != nil {
+			logger.Sugar.Errorf("[simulación] %s: no se pudo planificar: %v", file, err)
+			failed++
+			continue
+		}
+
+		action := actionCopy
+		if localInfo, err := os.Stat(localFilePath); err == nil {
+			action = conflictAction(cfg.OnConflict, info, localInfo)
+		}
+		switch action {
+		case actionCopy:
+			logger.Sugar.Infof("[simulación] %s -> %s: se descargaría (%d bytes)", remoteFilePath, localFilePath, info.Size())
+			downloads++
+		case actionOverwrite:
+			logger.Sugar.Infof("[simulación] %s -> %s: se sobrescribiría el archivo local (%d bytes)", remoteFilePath, localFilePath, info.Size())
+			overwrites++
+		case actionRename:
+			logger.Sugar.Infof("[simulación] %s -> %s: el archivo local ya existe, se descargaría con otro nombre (%d bytes)", remoteFilePath, localFilePath, info.Size())
+			renames++
+		case actionSkipExisting:
+			logger.Sugar.Infof("[simulación] %s -> %s: el archivo local ya existe, se omitiría", remoteFilePath, localFilePath)
+			skips++
+			continue
+		case actionFail:
+			logger.Sugar.Errorf("[simulación] %s -> %s: el archivo local ya existe, fallaría", remoteFilePath, localFilePath)
+			failed++
+			continue
+		}
+		if cfg.DeleteAfter {
+			deletes++
+			logger.Sugar.Infof("[simulación] %s: se eliminaría el archivo remoto %s", file, remoteFilePath)
+		}
+	}
+
+	logger.Sugar.Infof("[simulación] Resumen: %d a descargar, %d a sobrescribir, %d a renombrar, %d a omitir, %d fallarían, %d archivos remotos a eliminar",
+		downloads, overwrites, renames, skips, failed, deletes)
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d could not be planned", ErrIncomplete, failed, len(files))
+	}
+	return nil
+}
+
+// getRemoteRegexFiles lists the files under cfg.SharedPath whose path relative
+// to it matches cfg.Regex, descending into subdirectories in recursive mode.
+// Manifests are never listed.
+func getRemoteRegexFiles(fs RemoteFS, cfg *config.Config) []string {
+	logger.Sugar.Debugf("Escaneando directorio remoto '%s' con patrón regex: '%s'", cfg.SharedPath, cfg.Regex)
+
+	re, err := regexp.Compile("(?i)" + cfg.Regex)
+	if err != nil {
+		logger.Sugar.Errorf("Patrón regex inválido '%s': %v", cfg.Regex, err)
+		return nil
+	}
+	return walkRemote(fs, cfg, func(rel string) bool {
+		return re.MatchString(rel) && !isManifest(fs, filepath.Join(cfg.SharedPath, rel))
+	})
+}
+
+// walkRemote lists the files under cfg.SharedPath, other than part files, for
+// which match returns true, following the recursion settings of cfg.
+func walkRemote(fs RemoteFS, cfg *config.Config, match func(rel string) bool) []string {
+	var matchingFiles []string
+	var walk func(rel string, depth int) error
+	walk = func(rel string, depth int) error {
+		entries, err := fs.ReadDir(filepath.Join(cfg.SharedPath, rel))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			childRel := name
+			if rel != "" {
+				childRel = rel + "/" + name
+			}
+
+			if entry.IsDir() {
+				if !cfg.Recursive || (cfg.SkipHidden && strings.HasPrefix(name, ".")) {
+					continue
+				}
+				if cfg.MaxDepth > 0 && depth+1 > cfg.MaxDepth {
+					continue
+				}
+				if err := walk(childRel, depth+1); err != nil {
+					logger.Sugar.Warnf("No se pudo leer el directorio remoto '%s': %v", childRel, err)
+				}
+				continue
+			}
+
+			if isPartFile(name) {
+				continue
+			}
+			if match(childRel) {
+				matchingFiles = append(matchingFiles, childRel)
+				logger.Sugar.Debugf("Archivo remoto encontrado: %s", childRel)
+			}
+		}
+		return nil
+	}
+
+	if err := walk("", 0); err != nil {
+		logger.Sugar.Errorf("Error al leer directorio remoto '%s': %v", cfg.SharedPath, err)
+		return nil
+	}
+	return matchingFiles
+}
+
+// startDownload copies one remote file to a temporary local name while
+// hashing it, verifies the local copy against that hash and only then gives
+// it its final name and, if requested, deletes the remote original. An
+// existing local file is handled by the --on-conflict policy.
+func startDownload(job *syncJob, fileName string, t *transfer) (copyOutcome, error) {
+	remoteFilePath := filepath.Join(job.cfg.SharedPath, fileName)
+	localFilePath := filepath.Join(job.cfg.Path, filepath.FromSlash(fileName))
+
+	logger.Sugar.Infof("Iniciando descarga de archivo: %s", fileName)
+	logger.Sugar.Debugf("Ruta remota: %s -> Ruta local: %s", remoteFilePath, localFilePath)
+
+	localInfo, err := os.Stat(localFilePath)
+	if err == nil {
+		remoteInfo, err := job.fs.Stat(remoteFilePath)
+		if err != nil {
+			logger.Sugar.Errorf("Error al consultar el archivo remoto %s: %v", remoteFilePath, err)
+			return outcomeFailed, fmt.Errorf("could not stat remote file %s: %w", remoteFilePath, err)
+		}
+		switch conflictAction(job.cfg.OnConflict, remoteInfo, localInfo) {
+		case actionSkipExisting:
+			logger.Sugar.Infof("Conflicto en %s: el archivo local ya existe, se omite", localFilePath)
+			t.destination = localFilePath
+			return outcomeSkipped, nil
+		case actionFail:
+			logger.Sugar.Errorf("Conflicto en %s: el archivo local ya existe", localFilePath)
+			t.destination = localFilePath
+			return outcomeFailed, fmt.Errorf("%w: %s", errLocalExists, localFilePath)
+		case actionRename:
+			target, err := freeRemoteName(NewLocalFS(""), localFilePath, time.Now())
+			if err != nil {
+				logger.Sugar.Errorf("Error al buscar un nombre libre para %s: %v", localFilePath, err)
+				return outcomeFailed, err
+			}
+			logger.Sugar.Infof("Conflicto en %s: se descargará %s como %s", localFilePath, fileName, filepath.Base(target))
+			localFilePath = target
+		default:
+			logger.Sugar.Infof("Conflicto en %s: el archivo local se sobrescribe", localFilePath)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		logger.Sugar.Errorf("Error al consultar el archivo local %s: %v", localFilePath, err)
+		return outcomeFailed, fmt.Errorf("could not stat local file %s: %w", localFilePath, err)
+	}
+	partFilePath := partPath(localFilePath)
+	t.destination = localFilePath
+
+	if err := os.MkdirAll(filepath.Dir(localFilePath), 0755); err != nil {
+		logger.Sugar.Errorf("Error al crear directorio local %s: %v", filepath.Dir(localFilePath), err)
+		return outcomeFailed, fmt.Errorf("could not create local directory %s: %w", filepath.Dir(localFilePath), err)
+	}
+
+	sourceHashSum, size, err := download(job, remoteFilePath, partFilePath, fileName)
+	if err != nil {
+		os.Remove(partFilePath)
+		return outcomeFailed, err
+	}
+	t.bytes, t.sourceHash = size, sourceHashSum
+
+	localFile, err := os.Open(partFilePath)
+	if err != nil {
+		os.Remove(partFilePath)
+		return outcomeFailed, fmt.Errorf("could not reopen local file for verification: %w", err)
+	}
+	logger.Sugar.Infof("Fase: Verificación de integridad %s", job.hasher.Name())
+	t.destHash, err = verifyHash(job, localFile, size, sourceHashSum, fileName)
+	localFile.Close()
+	if err != nil {
+		os.Remove(partFilePath)
+		return outcomeFailed, err
+	}
+
+	if err := os.Rename(partFilePath, localFilePath); err != nil {
+		os.Remove(partFilePath)
+		logger.Sugar.Errorf("Error al renombrar archivo local %s: %v", localFilePath, err)
+		return outcomeFailed, fmt.Errorf("could not rename local file to %s: %w", localFilePath, err)
+	}
+
+	if job.cfg.DeleteAfter {
+		logger.Sugar.Infof("Eliminando archivo remoto original: %s", remoteFilePath)
+		if err := job.fs.Remove(remoteFilePath); err != nil {
+			logger.Sugar.Errorf("Fallo al eliminar el archivo remoto original %s: %v", remoteFilePath, err)
+			return outcomeFailed, fmt.Errorf("failed to delete remote file: %w", err)
+		}
+		logger.Sugar.Infof("Archivo remoto original %s eliminado.", remoteFilePath)
+		t.deleted = true
+	}
+	return outcomeCopied, nil
+}
+
+// download copies remoteFilePath into localFilePath and returns the hash of
+// the bytes read from the share together with their count.
+func download(job *syncJob, remoteFilePath, localFilePath, fileName string) ([]byte, int64, error) {
+	remoteFile, err := job.fs.Open(remoteFilePath)
+	if err != nil {
+		logger.Sugar.Errorf("Error al abrir archivo remoto %s: %v", remoteFilePath, err)
+		return nil, 0, fmt.Errorf("could not open remote file %s: %w", remoteFilePath, err)
+	}
+	defer remoteFile.Close()
+
+	info, err := remoteFile.Stat()
+	if err != nil {
+		logger.Sugar.Errorf("Error al obtener información del archivo remoto: %v", err)
+		return nil, 0, fmt.Errorf("could not get remote file info: %w", err)
+	}
+	logger.Sugar.Infof("Tamaño del archivo %s: %d bytes (%.2f MB)", fileName, info.Size(), float64(info.Size())/(1024*1024))
+
+	localFile, err := os.Create(localFilePath)
+	if err != nil {
+		logger.Sugar.Errorf("Error al crear archivo local %s: %v", localFilePath, err)
+		return nil, 0, fmt.Errorf("could not create local file %s: %w", localFilePath, err)
+	}
+
+	logger.Sugar.Infof("Fase: Descargando archivo y calculando hash %s", job.hasher.Name())
+	sourceHash := job.hasher.New()
+	n, err := io.Copy(io.MultiWriter(localFile, sourceHash, job.copyProgress(info.Size(), 0)), job.limiter.Reader(remoteFile))
+	if closeErr := localFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.Sugar.Errorf("Error durante la descarga del archivo %s: %v", fileName, err)
+		return nil, 0, fmt.Errorf("file download failed: %w", err)
+	}
+
+	logger.Sugar.Infof("Descarga completada para %s (%d bytes transferidos)", fileName, n)
+	sourceHashSum := sourceHash.Sum(nil)
+	logger.Sugar.Debugf("Hash %s del archivo remoto: %x", job.hasher.Name(), sourceHashSum)
+	return sourceHashSum, n, nil
+}
+
+// remoteTotalSize returns the combined size of files under basePath on the
+// share, ignoring files that cannot be read.
+func remoteTotalSize(fs RemoteFS, basePath string, files []string) int64 {
+	var total int64
+	for _, file := range files {
+		if info, err := fs.Stat(filepath.Join(basePath, file)); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
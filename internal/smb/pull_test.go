@@ -0,0 +1,231 @@
+package smb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/hvarillas/smbsync/internal/config"
+)
+
+// brokenReadFS returns files whose reads always fail.
+type brokenReadFS struct {
+	RemoteFS
+}
+
+type brokenReadFile struct {
+	RemoteFile
+}
+
+func (b *brokenReadFS) Open(name string) (RemoteFile, error) {
+	f, err := b.RemoteFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &brokenReadFile{f}, nil
+}
+
+func (b *brokenReadFile) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func newRemoteTree(t *testing.T, files map[string]string) RemoteFS {
+	t.Helper()
+	fs := NewMemFS()
+	for name, content := range files {
+		if err := fs.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		writeRemoteFile(t, fs, name, content)
+	}
+	return fs
+}
+
+func TestGetRemoteRegexFiles(t *testing.T) {
+	fs := newRemoteTree(t, map[string]string{
+		"exports/a.csv":               "a",
+		"exports/b.CSV":               "b",
+		"exports/readme.txt":          "r",
+		"exports/.c.csv.smbsync-part": "partial",
+		"exports/2024/d.csv":          "d",
+		"exports/2024/q1/e.csv":       "e",
+		"exports/.hidden/f.csv":       "f",
+	})
+
+	testCases := []struct {
+		name     string
+		cfg      config.Config
+		expected []string
+	}{
+		{
+			name:     "flat",
+			cfg:      config.Config{SharedPath: "exports", Regex: `\.csv$`},
+			expected: []string{"a.csv", "b.CSV"},
+		},
+		{
+			name:     "recursive",
+			cfg:      config.Config{SharedPath: "exports", Regex: `\.csv$`, Recursive: true, SkipHidden: true},
+			expected: []string{"2024/d.csv", "2024/q1/e.csv", "a.csv", "b.CSV"},
+		},
+		{
+			name:     "recursive with max depth",
+			cfg:      config.Config{SharedPath: "exports", Regex: `\.csv$`, Recursive: true, MaxDepth: 1, SkipHidden: true},
+			expected: []string{"2024/d.csv", "a.csv", "b.CSV"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := getRemoteRegexFiles(fs, &tc.cfg)
+			sort.Strings(got)
+			if len(got) != len(tc.expected) {
+				t.Fatalf("Expected %v, got %v", tc.expected, got)
+			}
+			for i := range got {
+				if got[i] != tc.expected[i] {
+					t.Errorf("Expected %v, got %v", tc.expected, got)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestPullFiles_DownloadVerifyDelete(t *testing.T) {
+	fs := newRemoteTree(t, map[string]string{
+		"exports/a.csv":      "alpha",
+		"exports/sub/b.csv":  "beta",
+		"exports/ignore.txt": "ignored",
+	})
+	localDir := t.TempDir()
+	cfg := &config.Config{
+		Path:        localDir,
+		SharedPath:  "exports",
+		Regex:       `\.csv$`,
+		Recursive:   true,
+		DeleteAfter: true,
+		Concurrency: 2,
+	}
+
+	files := getRemoteRegexFiles(fs, cfg)
+	if err := pullFiles(context.Background(), fs, cfg, files); err != nil {
+		t.Fatalf("pullFiles failed: %v", err)
+	}
+
+	for name, content := range map[string]string{"a.csv": "alpha", "sub/b.csv": "beta"} {
+		got, err := os.ReadFile(filepath.Join(localDir, filepath.FromSlash(name)))
+		if err != nil || string(got) != content {
+			t.Errorf("Expected local %s = %q, got %q (%v)", name, content, got, err)
+		}
+		if _, err := fs.Stat("exports/" + name); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected remote %s to be deleted, got %v", name, err)
+		}
+	}
+	if _, err := fs.Stat("exports/ignore.txt"); err != nil {
+		t.Errorf("Non matching remote file must be kept: %v", err)
+	}
+}
+
+func TestPullFiles_FailedDownloadKeepsRemote(t *testing.T) {
+	fs := &brokenReadFS{newRemoteTree(t, map[string]string{"exports/a.csv": "alpha"})}
+	localDir := t.TempDir()
+	cfg := &config.Config{Path: localDir, SharedPath: "exports", DeleteAfter: true}
+
+	if err := pullFiles(context.Background(), fs, cfg, []string{"a.csv"}); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Expected ErrIncomplete, got %v", err)
+	}
+	if _, err := fs.Stat("exports/a.csv"); err != nil {
+		t.Errorf("Remote file must be kept after a failed download: %v", err)
+	}
+	entries, _ := os.ReadDir(localDir)
+	if len(entries) != 0 {
+		t.Errorf("Expected no local leftovers, got %v", entries)
+	}
+}
+
+func TestPullFiles_OnConflict(t *testing.T) {
+	testCases := []struct {
+		policy     string
+		wantErr    bool
+		wantLocal  string
+		wantFiles  int
+		wantRemote bool
+	}{
+		{policy: config.ConflictOverwrite, wantLocal: "new", wantFiles: 1},
+		{policy: config.ConflictSkip, wantLocal: "old", wantFiles: 1, wantRemote: true},
+		{policy: config.ConflictFail, wantErr: true, wantLocal: "old", wantFiles: 1, wantRemote: true},
+		{policy: config.ConflictRename, wantLocal: "old", wantFiles: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.policy, func(t *testing.T) {
+			fs := newRemoteTree(t, map[string]string{"exports/a.csv": "new"})
+			localDir := t.TempDir()
+			writeTestFiles(t, localDir, map[string]string{"a.csv": "old"})
+			cfg := &config.Config{Path: localDir, SharedPath: "exports", OnConflict: tc.policy, DeleteAfter: true}
+
+			err := pullFiles(context.Background(), fs, cfg, []string{"a.csv"})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if got, _ := os.ReadFile(filepath.Join(localDir, "a.csv")); string(got) != tc.wantLocal {
+				t.Errorf("Expected local a.csv = %q, got %q", tc.wantLocal, got)
+			}
+			if entries, _ := os.ReadDir(localDir); len(entries) != tc.wantFiles {
+				t.Errorf("Expected %d local files, got %v", tc.wantFiles, entries)
+			}
+			if _, err := fs.Stat("exports/a.csv"); (err == nil) != tc.wantRemote {
+				t.Errorf("Expected remote kept = %v, got %v", tc.wantRemote, err)
+			}
+		})
+	}
+}
+
+func TestRunPull_LocalTarget(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeTestFiles(t, sourceDir, map[string]string{"out/report.csv": "data"})
+	localDir := t.TempDir()
+
+	cfg := &config.Config{
+		Path:       localDir,
+		SharedPath: "out",
+		Regex:      `\.csv$`,
+		TargetDir:  sourceDir,
+	}
+	if err := RunPull(cfg); err != nil {
+		t.Fatalf("RunPull failed: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(localDir, "report.csv")); err != nil || string(got) != "data" {
+		t.Errorf("Expected downloaded report.csv, got %q (%v)", got, err)
+	}
+}
+
+func TestRunPull_DryRunTouchesNothing(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeTestFiles(t, sourceDir, map[string]string{"out/a.csv": "alpha", "out/b.csv": "beta"})
+	localDir := t.TempDir()
+
+	cfg := &config.Config{
+		Path:        localDir,
+		SharedPath:  "out",
+		Regex:       `\.csv$`,
+		TargetDir:   sourceDir,
+		DeleteAfter: true,
+		DryRun:      true,
+	}
+	if err := RunPull(cfg); err != nil {
+		t.Fatalf("RunPull failed: %v", err)
+	}
+
+	for _, name := range []string{"a.csv", "b.csv"} {
+		if _, err := os.Stat(filepath.Join(sourceDir, "out", name)); err != nil {
+			t.Errorf("Remote %s must be kept by a dry run: %v", name, err)
+		}
+	}
+	if entries, _ := os.ReadDir(localDir); len(entries) != 0 {
+		t.Errorf("Expected nothing downloaded, got %v", entries)
+	}
+}
@@ -0,0 +1,205 @@
+package smb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/hvarillas/smbsync/internal/checksum"
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+)
+
+// verifyCounts tallies the result of every file of a verify run.
+type verifyCounts struct {
+	mu                                sync.Mutex
+	ok, changed, missing, extra, errs int
+}
+
+func (c *verifyCounts) add(n *int) {
+	c.mu.Lock()
+	*n++
+	c.mu.Unlock()
+}
+
+// RunVerify rereads the remote files under cfg.SharedPath that match cfg.Regex
+// and compares them with the hashes recorded in their manifests. A file listed
+// in a manifest but gone from the share is missing, one whose hash differs is
+// changed and one without a manifest entry is extra; any of them makes it
+// return ErrMismatch.
+func RunVerify(ctx context.Context, cfg *config.Config) error {
+	logger.Sugar.Info("Iniciando verificación de los archivos remotos contra sus manifiestos.")
+
+	fs, err := openSessionContext(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	return verifyRemote(ctx, fs, cfg)
+}
+
+func verifyRemote(ctx context.Context, fs RemoteFS, cfg *config.Config) error {
+	job := newSyncJob(ctx, fs, cfg, "verify")
+	counts := &verifyCounts{}
+
+	re, err := regexp.Compile("(?i)" + cfg.Regex)
+	if err != nil {
+		return fmt.Errorf("invalid regex %q: %w", cfg.Regex, err)
+	}
+	expected := loadManifests(fs, cfg, counts)
+	for name := range expected {
+		if !re.MatchString(name) {
+			delete(expected, name)
+		}
+	}
+
+	var files []string
+	for _, name := range getRemoteRegexFiles(fs, cfg) {
+		if _, ok := expected[name]; ok {
+			files = append(files, name)
+			continue
+		}
+		logger.Sugar.Warnf("Sin manifiesto: %s no aparece en ningún manifiesto", name)
+		counts.extra++
+	}
+
+	present := map[string]bool{}
+	for _, name := range files {
+		present[name] = true
+	}
+	var missing []string
+	for name := range expected {
+		if !present[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		logger.Sugar.Errorf("Falta: %s figura en el manifiesto pero no existe en el destino", name)
+		counts.missing++
+	}
+
+	workers := workerCount(cfg.Concurrency, len(files))
+	if workers > 1 {
+		logger.Sugar.Infof("Verificando con %d lecturas en paralelo", workers)
+		job.progress = newProgressBar(remoteTotalSize(fs, cfg.SharedPath, files), fmt.Sprintf("Verificando (%d en paralelo)...", workers))
+	}
+
+	_, notStarted := runPool(ctx, workers, files, func(file string) error {
+		return job.verifyFile(file, expected[file], counts)
+	})
+
+	if job.progress != nil {
+		job.progress.Finish()
+	}
+	if notStarted > 0 {
+		logger.Sugar.Warnf("Verificación interrumpida: %d archivos sin verificar", notStarted)
+	}
+	logger.Sugar.Infof("Resumen: %d correctos, %d modificados, %d faltantes, %d sin manifiesto, %d errores",
+		counts.ok, counts.changed, counts.missing, counts.extra, counts.errs)
+
+	if counts.changed+counts.missing+counts.extra > 0 {
+		return fmt.Errorf("%w: %d changed, %d missing, %d without manifest", ErrMismatch, counts.changed, counts.missing, counts.extra)
+	}
+	return runResult(counts.errs, notStarted, len(files))
+}
+
+// verifyFile rereads one remote file and compares its hash with want, using
+// the algorithm recorded in the manifest.
+func (j *syncJob) verifyFile(file string, want manifestEntry, counts *verifyCounts) error {
+	hasher, err := checksum.Get(want.algorithm)
+	if err != nil {
+		logger.Sugar.Errorf("No se puede verificar %s: algoritmo %s no soportado", file, want.algorithm)
+		counts.add(&counts.errs)
+		return err
+	}
+
+	var got []byte
+	err = j.withRetry(file, func() error {
+		var err error
+		got, err = j.hashRemote(filepath.Join(j.cfg.SharedPath, file), hasher)
+		return err
+	})
+	if err != nil {
+		logger.Sugar.Errorf("No se pudo leer %s para verificarlo: %v", file, err)
+		counts.add(&counts.errs)
+		return err
+	}
+
+	if !bytes.Equal(got, want.hash) {
+		logger.Sugar.Errorf("Modificado: %s no coincide con su manifiesto (esperado %x, obtenido %x)", file, want.hash, got)
+		counts.add(&counts.changed)
+		return errHashMismatch
+	}
+	logger.Sugar.Infof("Verificado: %s", file)
+	counts.add(&counts.ok)
+	return nil
+}
+
+// hashRemote returns the hash of a remote file.
+func (j *syncJob) hashRemote(remotePath string, hasher checksum.Hasher) ([]byte, error) {
+	f, err := j.fs.Open(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var bar io.Writer = j.progress
+	if j.progress == nil {
+		bar = newProgressBar(info.Size(), "Verificando...")
+	}
+	h := hasher.New()
+	if _, err := io.Copy(io.MultiWriter(h, bar), j.limiter.Reader(f)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// loadManifests reads every manifest under cfg.SharedPath and returns the
+// recorded entries keyed by the path of the file relative to cfg.SharedPath.
+// An entry of a sidecar manifest wins over the same file in a directory
+// manifest. Manifests that cannot be read are logged and counted as errors.
+func loadManifests(fs RemoteFS, cfg *config.Config, counts *verifyCounts) map[string]manifestEntry {
+	manifests := walkRemote(fs, cfg, func(rel string) bool {
+		return isManifest(fs, filepath.Join(cfg.SharedPath, rel))
+	})
+	// Directory manifests first, so sidecars override them.
+	sort.SliceStable(manifests, func(i, k int) bool {
+		_, sidecarI, _ := manifestKind(manifests[i])
+		_, sidecarK, _ := manifestKind(manifests[k])
+		return !sidecarI && sidecarK
+	})
+
+	expected := map[string]manifestEntry{}
+	for _, manifest := range manifests {
+		entries, err := readManifest(fs, filepath.Join(cfg.SharedPath, manifest))
+		if err != nil {
+			logger.Sugar.Errorf("No se pudo leer el manifiesto %s: %v", manifest, err)
+			counts.errs++
+			continue
+		}
+
+		dir, base := path.Split(manifest)
+		algorithm, sidecar, _ := manifestKind(manifest)
+		for name, entry := range entries {
+			if sidecar && name != base[:len(base)-len(sidecarSuffix(algorithm))] {
+				logger.Sugar.Warnf("El manifiesto %s describe %s, que no le corresponde; se ignora", manifest, name)
+				continue
+			}
+			expected[path.Join(dir, filepath.ToSlash(name))] = entry
+		}
+	}
+	logger.Sugar.Infof("Encontrados %d manifiestos con %d archivos", len(manifests), len(expected))
+	return expected
+}
@@ -0,0 +1,55 @@
+package smb
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/logger"
+	"github.com/hvarillas/smbsync/internal/report"
+)
+
+// transfer collects what happened to one file for the run report.
+type transfer struct {
+	destination string
+	bytes       int64
+	sourceHash  []byte
+	destHash    []byte
+	deleted     bool
+}
+
+// record adds the result of a file to the run report, if one is being kept.
+func (j *syncJob) record(file string, t *transfer, outcome copyOutcome, err error, elapsed time.Duration) {
+	if j.report == nil {
+		return
+	}
+
+	entry := report.Entry{
+		File:        file,
+		Destination: t.destination,
+		Outcome:     report.Outcome(outcome),
+		Bytes:       t.bytes,
+		Duration:    elapsed.Seconds(),
+		SourceHash:  hex.EncodeToString(t.sourceHash),
+		DestHash:    hex.EncodeToString(t.destHash),
+	}
+	if err != nil {
+		entry.Outcome = report.Failed
+		entry.Error = err.Error()
+	} else if t.deleted {
+		entry.Outcome = report.Deleted
+	}
+	j.report.Add(entry)
+}
+
+// writeReport finishes the run report and writes it to cfg.Report.
+func (j *syncJob) writeReport() {
+	if j.report == nil {
+		return
+	}
+	j.report.Finish()
+	if err := j.report.WriteFile(j.cfg.Report, j.cfg.ReportFormat); err != nil {
+		logger.Sugar.Errorf("No se pudo escribir el reporte %s: %v", j.cfg.Report, err)
+		return
+	}
+	logger.Sugar.Infof("Reporte de la ejecución escrito en %s", j.cfg.Report)
+}
@@ -0,0 +1,106 @@
+package smb
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/report"
+)
+
+func readReport(t *testing.T, path string) *report.Report {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	r := &report.Report{}
+	if err := json.Unmarshal(data, r); err != nil {
+		t.Fatalf("Invalid report: %v", err)
+	}
+	return r
+}
+
+func TestSyncFiles_Report(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"new.bak": "new content", "old.bak": "old"})
+
+	fs := NewMemFS()
+	writeRemoteFile(t, fs, "old.bak", "remote")
+
+	reportPath := filepath.Join(t.TempDir(), "run.json")
+	cfg := &config.Config{Path: localDir, SharedPath: ".", OnConflict: config.ConflictSkip, Report: reportPath, Hash: "xxh3"}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"new.bak", "old.bak"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+
+	r := readReport(t, reportPath)
+	if r.Command != "push" || r.Totals.Copied != 1 || r.Totals.Skipped != 1 {
+		t.Fatalf("Unexpected report totals: %+v", r.Totals)
+	}
+	if r.HashAlgorithm != "XXH3" {
+		t.Errorf("Expected the hash algorithm XXH3, got %q", r.HashAlgorithm)
+	}
+	copied := r.Files[0]
+	if copied.File != "new.bak" || copied.Outcome != report.Copied {
+		t.Fatalf("Expected new.bak to be copied, got %+v", copied)
+	}
+	if copied.Bytes != int64(len("new content")) {
+		t.Errorf("Expected %d bytes, got %d", len("new content"), copied.Bytes)
+	}
+	if len(copied.SourceHash) != 16 || copied.SourceHash != copied.DestHash {
+		t.Errorf("Expected matching hashes, got %q and %q", copied.SourceHash, copied.DestHash)
+	}
+	if r.Files[1].Outcome != report.Skipped {
+		t.Errorf("Expected old.bak to be skipped, got %s", r.Files[1].Outcome)
+	}
+}
+
+func TestSyncFiles_ReportFailureAndDelete(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "alpha"})
+
+	reportPath := filepath.Join(t.TempDir(), "run.json")
+	cfg := &config.Config{Path: localDir, SharedPath: ".", DeleteAfter: true, Report: reportPath}
+	if err := syncFiles(context.Background(), NewMemFS(), cfg, []string{"a.bak"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+	if r := readReport(t, reportPath); r.Files[0].Outcome != report.Deleted {
+		t.Errorf("Expected deleted outcome, got %s", r.Files[0].Outcome)
+	}
+
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "alpha"})
+	fs := &faultyFS{RemoteFS: NewMemFS(), corrupt: true}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"}); err == nil {
+		t.Fatal("Expected corrupted copy to fail")
+	}
+	r := readReport(t, reportPath)
+	failed := r.Files[0]
+	if failed.Outcome != report.Failed || failed.Error == "" {
+		t.Errorf("Expected failed outcome with error, got %+v", failed)
+	}
+	if failed.SourceHash == failed.DestHash {
+		t.Errorf("Expected differing hashes for a corrupted copy, got %q", failed.DestHash)
+	}
+}
+
+func TestPullFiles_Report(t *testing.T) {
+	fs := NewMemFS()
+	writeRemoteFile(t, fs, "a.csv", "alpha")
+
+	reportPath := filepath.Join(t.TempDir(), "pull.csv")
+	cfg := &config.Config{Path: t.TempDir(), SharedPath: ".", Report: reportPath}
+	if err := pullFiles(context.Background(), fs, cfg, []string{"a.csv"}); err != nil {
+		t.Fatalf("pullFiles failed: %v", err)
+	}
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	if len(data) == 0 || data[0] != 'f' {
+		t.Errorf("Expected a CSV report, got %q", string(data))
+	}
+}
@@ -0,0 +1,224 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/checksum"
+	"github.com/hvarillas/smbsync/internal/logger"
+)
+
+// resumeCheckpoint is how many bytes are copied between journal saves.
+const resumeCheckpoint = 64 << 20
+
+// resumeJournal persists the progress of in-flight transfers so that a later
+// run, even from a new process, can continue a partial remote file instead of
+// starting from byte zero. A nil journal disables resuming.
+type resumeJournal struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]resumeEntry
+}
+
+// resumeEntry identifies the local file a partial remote file belongs to.
+type resumeEntry struct {
+	Local   string    `json:"local"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Offset  int64     `json:"offset"`
+	Updated time.Time `json:"updated"`
+}
+
+func loadResumeJournal(path string) (*resumeJournal, error) {
+	j := &resumeJournal{path: path, entries: map[string]resumeEntry{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read resume journal %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &j.entries); err != nil {
+		logger.Sugar.Warnf("Diario de reanudación %s corrupto, se descarta: %v", path, err)
+		j.entries = map[string]resumeEntry{}
+	}
+	return j, nil
+}
+
+// lookup returns the entry for remotePath if it was recorded for the same
+// version (size and modification time) of the local file.
+func (j *resumeJournal) lookup(remotePath string, local os.FileInfo) (resumeEntry, bool) {
+	if j == nil {
+		return resumeEntry{}, false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, ok := j.entries[remotePath]
+	if !ok || entry.Size != local.Size() || !entry.ModTime.Equal(local.ModTime()) {
+		return resumeEntry{}, false
+	}
+	return entry, true
+}
+
+func (j *resumeJournal) record(remotePath, localPath string, local os.FileInfo, offset int64) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries[remotePath] = resumeEntry{
+		Local:   localPath,
+		Size:    local.Size(),
+		ModTime: local.ModTime(),
+		Offset:  offset,
+		Updated: time.Now(),
+	}
+	return j.save()
+}
+
+func (j *resumeJournal) forget(remotePath string) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, ok := j.entries[remotePath]; !ok {
+		return nil
+	}
+	delete(j.entries, remotePath)
+	return j.save()
+}
+
+// save writes the journal atomically. The caller must hold j.mu.
+func (j *resumeJournal) save() error {
+	data, err := json.MarshalIndent(j.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return fmt.Errorf("could not write resume journal: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not write resume journal: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not write resume journal: %w", err)
+	}
+	return os.Rename(tmp.Name(), j.path)
+}
+
+// journalWriter records the number of bytes written through it in the journal
+// every resumeCheckpoint bytes.
+type journalWriter struct {
+	journal    *resumeJournal
+	remotePath string
+	localPath  string
+	local      os.FileInfo
+	offset     int64
+	saved      int64
+}
+
+func (w *journalWriter) Write(p []byte) (int, error) {
+	w.offset += int64(len(p))
+	if w.offset-w.saved >= resumeCheckpoint {
+		w.checkpoint()
+	}
+	return len(p), nil
+}
+
+func (w *journalWriter) checkpoint() {
+	if err := w.journal.record(w.remotePath, w.localPath, w.local, w.offset); err != nil {
+		logger.Sugar.Warnf("No se pudo actualizar el diario de reanudación: %v", err)
+		return
+	}
+	w.saved = w.offset
+}
+
+// openForResume opens remotePath positioned where the copy must continue.
+// When the journal has an entry for the same local file version and the
+// already transferred remote prefix hashes the same as the local one, the
+// remote file is reopened and both localFile and sourceHash are advanced past
+// that prefix. Otherwise the remote file is created from scratch.
+func openForResume(fs RemoteFS, journal *resumeJournal, remotePath string, identity os.FileInfo, localFile *os.File, localSize int64, hasher checksum.Hasher, sourceHash hash.Hash) (RemoteFile, int64, error) {
+	if _, ok := journal.lookup(remotePath, identity); ok {
+		remoteFile, offset, err := resumeRemoteFile(fs, remotePath, localFile, localSize, hasher, sourceHash)
+		if err == nil && offset > 0 {
+			return remoteFile, offset, nil
+		}
+		if err != nil {
+			logger.Sugar.Warnf("No se puede reanudar %s, se copiará desde el inicio: %v", remotePath, err)
+		}
+		if _, err := localFile.Seek(0, io.SeekStart); err != nil {
+			return nil, 0, fmt.Errorf("could not rewind local file: %w", err)
+		}
+		sourceHash.Reset()
+	}
+
+	remoteFile, err := fs.Create(remotePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	return remoteFile, 0, nil
+}
+
+func resumeRemoteFile(fs RemoteFS, remotePath string, localFile *os.File, localSize int64, hasher checksum.Hasher, sourceHash hash.Hash) (RemoteFile, int64, error) {
+	info, err := fs.Stat(remotePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset := info.Size()
+	if offset == 0 {
+		return nil, 0, nil
+	}
+	if offset > localSize {
+		return nil, 0, fmt.Errorf("remote file is larger than local file (%d > %d bytes)", offset, localSize)
+	}
+
+	remoteFile, err := fs.OpenFile(remotePath, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	logger.Sugar.Infof("Verificando %d bytes ya transferidos de %s", offset, remotePath)
+	remoteHash := hasher.New()
+	if _, err := io.CopyN(remoteHash, remoteFile, offset); err != nil {
+		remoteFile.Close()
+		return nil, 0, fmt.Errorf("could not read remote prefix: %w", err)
+	}
+
+	localHash := hasher.New()
+	if _, err := io.CopyN(io.MultiWriter(localHash, sourceHash), localFile, offset); err != nil {
+		remoteFile.Close()
+		return nil, 0, fmt.Errorf("could not read local prefix: %w", err)
+	}
+
+	if !bytes.Equal(remoteHash.Sum(nil), localHash.Sum(nil)) {
+		remoteFile.Close()
+		return nil, 0, fmt.Errorf("remote prefix does not match local file")
+	}
+
+	if _, err := remoteFile.Seek(offset, io.SeekStart); err != nil {
+		remoteFile.Close()
+		return nil, 0, fmt.Errorf("could not seek remote file: %w", err)
+	}
+
+	logger.Sugar.Infof("Reanudando %s desde el byte %d (%.2f MB)", remotePath, offset, float64(offset)/(1024*1024))
+	return remoteFile, offset, nil
+}
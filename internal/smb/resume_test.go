@@ -0,0 +1,194 @@
+package smb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hvarillas/smbsync/internal/config"
+)
+
+// countingFS records how many bytes are written through files it opens.
+type countingFS struct {
+	RemoteFS
+	written int64
+}
+
+type countingFile struct {
+	RemoteFile
+	fs *countingFS
+}
+
+func (c *countingFS) Create(name string) (RemoteFile, error) {
+	f, err := c.RemoteFS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &countingFile{RemoteFile: f, fs: c}, nil
+}
+
+func (c *countingFS) OpenFile(name string, flag int, perm os.FileMode) (RemoteFile, error) {
+	f, err := c.RemoteFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &countingFile{RemoteFile: f, fs: c}, nil
+}
+
+func (f *countingFile) Write(p []byte) (int, error) {
+	n, err := f.RemoteFile.Write(p)
+	f.fs.written += int64(n)
+	return n, err
+}
+
+func writeRemoteFile(t *testing.T, fs RemoteFS, name, content string) {
+	t.Helper()
+	f, err := fs.Create(name)
+	if err != nil {
+		t.Fatalf("Failed to create remote file %s: %v", name, err)
+	}
+	if _, err := f.Write([]byte(content)); err != nil {
+		t.Fatalf("Failed to write remote file %s: %v", name, err)
+	}
+	f.Close()
+}
+
+// prepareResume creates a local file, a partial remote copy and a journal
+// entry as an interrupted run would have left them.
+func prepareResume(t *testing.T, content, remotePrefix string) (*config.Config, *countingFS) {
+	t.Helper()
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"dump.sql": content})
+
+	fs := &countingFS{RemoteFS: NewMemFS()}
+	writeRemoteFile(t, fs.RemoteFS, partPath("dump.sql"), remotePrefix)
+
+	statePath := filepath.Join(t.TempDir(), "resume.json")
+	journal, err := loadResumeJournal(statePath)
+	if err != nil {
+		t.Fatalf("loadResumeJournal failed: %v", err)
+	}
+	localPath := filepath.Join(localDir, "dump.sql")
+	info, _ := os.Stat(localPath)
+	if err := journal.record(partPath("dump.sql"), localPath, info, int64(len(remotePrefix))); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+
+	return &config.Config{Path: localDir, SharedPath: ".", Resume: true, ResumeState: statePath}, fs
+}
+
+func TestSyncFiles_ResumesPartialFile(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	cfg, fs := prepareResume(t, content, content[:4000])
+
+	if err := syncFiles(context.Background(), fs, cfg, []string{"dump.sql"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+	if got := readRemoteFile(t, fs, "dump.sql"); got != content {
+		t.Fatalf("Remote content mismatch after resume (len %d)", len(got))
+	}
+	if fs.written != 6000 {
+		t.Errorf("Expected only the missing 6000 bytes to be written, got %d", fs.written)
+	}
+
+	journal, _ := loadResumeJournal(cfg.ResumeState)
+	if len(journal.entries) != 0 {
+		t.Errorf("Expected journal entry to be removed after success, got %v", journal.entries)
+	}
+}
+
+func TestSyncFiles_ResumeRestartsOnPrefixMismatch(t *testing.T) {
+	content := strings.Repeat("abcdefghij", 100)
+	cfg, fs := prepareResume(t, content, "corrupted prefix")
+
+	if err := syncFiles(context.Background(), fs, cfg, []string{"dump.sql"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+	if got := readRemoteFile(t, fs, "dump.sql"); got != content {
+		t.Fatalf("Remote content mismatch after restart")
+	}
+	if fs.written != int64(len(content)) {
+		t.Errorf("Expected full copy of %d bytes, got %d", len(content), fs.written)
+	}
+}
+
+func TestSyncFiles_ResumeIgnoresStaleJournal(t *testing.T) {
+	content := strings.Repeat("x", 500)
+	cfg, fs := prepareResume(t, content, content[:100])
+
+	// A newer version of the local file invalidates the journal entry.
+	localPath := filepath.Join(cfg.Path, "dump.sql")
+	if err := os.WriteFile(localPath, []byte(content+"more"), 0644); err != nil {
+		t.Fatalf("Failed to rewrite local file: %v", err)
+	}
+
+	if err := syncFiles(context.Background(), fs, cfg, []string{"dump.sql"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+	if fs.written != int64(len(content)+4) {
+		t.Errorf("Expected full copy of %d bytes, got %d", len(content)+4, fs.written)
+	}
+}
+
+func TestSyncFiles_WithoutResumeCopiesFromScratch(t *testing.T) {
+	content := strings.Repeat("y", 300)
+	cfg, fs := prepareResume(t, content, content[:200])
+	cfg.Resume = false
+
+	if err := syncFiles(context.Background(), fs, cfg, []string{"dump.sql"}); err != nil {
+		t.Fatalf("syncFiles failed: %v", err)
+	}
+	if fs.written != int64(len(content)) {
+		t.Errorf("Expected full copy of %d bytes, got %d", len(content), fs.written)
+	}
+}
+
+func TestResumeJournal_Persistence(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	localPath := filepath.Join(t.TempDir(), "file.bak")
+	if err := os.WriteFile(localPath, []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to create local file: %v", err)
+	}
+	info, _ := os.Stat(localPath)
+
+	journal, err := loadResumeJournal(statePath)
+	if err != nil {
+		t.Fatalf("loadResumeJournal failed: %v", err)
+	}
+	if err := journal.record("remote/file.bak", localPath, info, 2); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+
+	reloaded, err := loadResumeJournal(statePath)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	entry, ok := reloaded.lookup("remote/file.bak", info)
+	if !ok || entry.Offset != 2 || entry.Local != localPath {
+		t.Fatalf("Unexpected journal entry after reload: %+v (found=%v)", entry, ok)
+	}
+
+	if err := reloaded.forget("remote/file.bak"); err != nil {
+		t.Fatalf("forget failed: %v", err)
+	}
+	reloaded, _ = loadResumeJournal(statePath)
+	if _, ok := reloaded.lookup("remote/file.bak", info); ok {
+		t.Error("Expected entry to be forgotten")
+	}
+}
+
+func TestResumeJournal_CorruptFileIsDiscarded(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(statePath, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+	journal, err := loadResumeJournal(statePath)
+	if err != nil {
+		t.Fatalf("Expected corrupt journal to be discarded, got error %v", err)
+	}
+	if len(journal.entries) != 0 {
+		t.Errorf("Expected empty journal, got %v", journal.entries)
+	}
+}
@@ -0,0 +1,194 @@
+package smb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+)
+
+// errHashMismatch is returned when a copy does not hash like its source.
+var errHashMismatch = errors.New("hash mismatch: file corruption likely")
+
+// errorClass tells the retry loop what to do after a failure.
+type errorClass int
+
+const (
+	// errPermanent failures are not retried.
+	errPermanent errorClass = iota
+	// errTransient failures are retried on the same connection.
+	errTransient
+	// errDisconnected failures are retried after reconnecting.
+	errDisconnected
+)
+
+// NTSTATUS codes that go-smb2 reports as *smb2.ResponseError.
+const (
+	statusSharingViolation      = 0xC0000043
+	statusFileLockConflict      = 0xC0000054
+	statusInsufficientResources = 0xC000009A
+	statusIOTimeout             = 0xC00000B5
+	statusNetworkBusy           = 0xC00000BF
+	statusUnexpectedNetworkErr  = 0xC00000C4
+	statusNetworkNameDeleted    = 0xC00000C9
+	statusRequestNotAccepted    = 0xC00000D0
+	statusUserSessionDeleted    = 0xC0000203
+	statusConnectionDisconnect  = 0xC000020C
+	statusConnectionReset       = 0xC000020D
+	statusNetworkUnreachable    = 0xC000023C
+	statusHostUnreachable       = 0xC000023D
+	statusConnectionAborted     = 0xC0000241
+	statusNetworkSessionExpired = 0xC000035C
+)
+
+// classifyError decides whether err is worth retrying and whether the SMB
+// session has to be re-established first.
+func classifyError(err error) errorClass {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return errPermanent
+	}
+
+	var respErr *smb2.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.Code {
+		case statusSharingViolation, statusFileLockConflict, statusInsufficientResources,
+			statusIOTimeout, statusNetworkBusy, statusRequestNotAccepted:
+			return errTransient
+		case statusUnexpectedNetworkErr, statusNetworkNameDeleted, statusUserSessionDeleted,
+			statusConnectionDisconnect, statusConnectionReset, statusNetworkUnreachable,
+			statusHostUnreachable, statusConnectionAborted, statusNetworkSessionExpired:
+			return errDisconnected
+		}
+		// Logon failures, access denied, missing shares or files...
+		return errPermanent
+	}
+
+	var transportErr *smb2.TransportError
+	var invalidErr *smb2.InvalidResponseError
+	var ctxErr *smb2.ContextError
+	if errors.As(err, &transportErr) || errors.As(err, &invalidErr) || errors.As(err, &ctxErr) {
+		return errDisconnected
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return errPermanent
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ETIMEDOUT) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, os.ErrDeadlineExceeded) {
+		return errDisconnected
+	}
+
+	if errors.Is(err, errHashMismatch) {
+		return errTransient
+	}
+	if errors.Is(err, ErrConnection) {
+		return errDisconnected
+	}
+	return errPermanent
+}
+
+// retryPolicy bounds how often and how fast a failed operation is retried.
+type retryPolicy struct {
+	attempts int
+	delay    time.Duration
+	maxDelay time.Duration
+	jitter   float64
+}
+
+func newRetryPolicy(cfg *config.Config) retryPolicy {
+	p := retryPolicy{
+		attempts: cfg.Retries + 1,
+		delay:    cfg.RetryDelay,
+		maxDelay: cfg.RetryMaxDelay,
+		jitter:   cfg.RetryJitter,
+	}
+	if p.attempts < 1 {
+		p.attempts = 1
+	}
+	return p
+}
+
+// backoff returns how long to wait after the given failed attempt (1-based):
+// delay doubled on every attempt, capped at maxDelay and spread by ±jitter.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.delay
+	for i := 1; i < attempt && d > 0; i++ {
+		d *= 2
+		if p.maxDelay > 0 && d >= p.maxDelay {
+			break
+		}
+	}
+	if p.maxDelay > 0 && d > p.maxDelay {
+		d = p.maxDelay
+	}
+	if p.jitter > 0 && d > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * p.jitter * float64(d))
+	}
+	return d
+}
+
+// reconnector is implemented by destinations that can re-establish their
+// connection. generation identifies the current connection so concurrent
+// workers that hit the same outage reconnect only once.
+type reconnector interface {
+	generation() int
+	reconnect(gen int) error
+}
+
+// withRetry runs attempt until it succeeds, fails permanently or the policy
+// runs out of attempts, reconnecting the destination when the connection was
+// lost.
+func (j *syncJob) withRetry(file string, attempt func() error) error {
+	policy := newRetryPolicy(j.cfg)
+	conn, _ := j.fs.(reconnector)
+
+	for n := 1; ; n++ {
+		gen := 0
+		if conn != nil {
+			gen = conn.generation()
+		}
+
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+		class := classifyError(err)
+		if class == errPermanent || n >= policy.attempts {
+			return err
+		}
+
+		wait := policy.backoff(n)
+		logger.Sugar.Warnf("Intento %d de %d para %s falló: %v. Reintentando en %s", n, policy.attempts, file, err, wait.Round(time.Millisecond))
+		select {
+		case <-time.After(wait):
+		case <-j.ctx.Done():
+			return err
+		}
+
+		if class == errDisconnected && conn != nil {
+			if err := conn.reconnect(gen); err != nil {
+				logger.Sugar.Errorf("No se pudo restablecer la conexión: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package smb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+	"github.com/hvarillas/smbsync/internal/config"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errorClass
+	}{
+		{"nil", nil, errPermanent},
+		{"canceled", context.Canceled, errPermanent},
+		{"not exist", &os.PathError{Op: "open", Path: "a", Err: os.ErrNotExist}, errPermanent},
+		{"logon failure", &smb2.ResponseError{Code: 0xC000006D}, errPermanent},
+		{"sharing violation", &os.PathError{Op: "open", Path: "a", Err: &smb2.ResponseError{Code: statusSharingViolation}}, errTransient},
+		{"session deleted", &smb2.ResponseError{Code: statusUserSessionDeleted}, errDisconnected},
+		{"transport", &smb2.TransportError{Err: io.EOF}, errDisconnected},
+		{"connection reset", fmt.Errorf("file copy failed: %w", &net.OpError{Op: "write", Err: syscall.ECONNRESET}), errDisconnected},
+		{"unexpected eof", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), errDisconnected},
+		{"unknown host", &net.DNSError{Err: "no such host", Name: "nas", IsNotFound: true}, errPermanent},
+		{"dial failure", fmt.Errorf("%w: %w", ErrConnection, &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}), errDisconnected},
+		{"bad credentials", fmt.Errorf("%w: %w", ErrConnection, &smb2.ResponseError{Code: 0xC000006D}), errPermanent},
+		{"hash mismatch", errHashMismatch, errTransient},
+		{"conflict", fmt.Errorf("%w: a.bak", errRemoteExists), errPermanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.want {
+				t.Errorf("Expected class %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := retryPolicy{attempts: 5, delay: time.Second, maxDelay: 5 * time.Second}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := p.backoff(i + 1); got != w {
+			t.Errorf("Expected backoff %s after attempt %d, got %s", w, i+1, got)
+		}
+	}
+
+	p.jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(1); got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Fatalf("Expected jittered backoff within 0.5s-1.5s, got %s", got)
+		}
+	}
+}
+
+// flakyFS fails the first creates with the given error and counts reconnects.
+type flakyFS struct {
+	RemoteFS
+	failures   int
+	err        error
+	creates    int
+	reconnects int
+	gen        int
+}
+
+func (f *flakyFS) Create(name string) (RemoteFile, error) {
+	f.creates++
+	if f.failures > 0 {
+		f.failures--
+		return nil, f.err
+	}
+	return f.RemoteFS.Create(name)
+}
+
+func (f *flakyFS) generation() int { return f.gen }
+
+func (f *flakyFS) reconnect(gen int) error {
+	if gen == f.gen {
+		f.gen++
+		f.reconnects++
+	}
+	return nil
+}
+
+func TestSyncFiles_RetriesTransientErrors(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "alpha"})
+
+	fs := &flakyFS{RemoteFS: NewMemFS(), failures: 2, err: &net.OpError{Op: "write", Err: syscall.ECONNRESET}}
+	cfg := &config.Config{Path: localDir, SharedPath: ".", DeleteAfter: true, Retries: 2}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"}); err != nil {
+		t.Fatalf("Expected the retries to succeed, got %v", err)
+	}
+
+	if fs.creates != 3 || fs.reconnects != 2 {
+		t.Errorf("Expected 3 attempts and 2 reconnects, got %d and %d", fs.creates, fs.reconnects)
+	}
+	if got := readRemoteFile(t, fs, "a.bak"); got != "alpha" {
+		t.Errorf("Expected remote content alpha, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(localDir, "a.bak")); !os.IsNotExist(err) {
+		t.Error("Expected local file to be deleted after the successful retry")
+	}
+}
+
+func TestSyncFiles_RetriesExhausted(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "alpha"})
+
+	fs := &flakyFS{RemoteFS: NewMemFS(), failures: 10, err: &smb2.ResponseError{Code: statusSharingViolation}}
+	cfg := &config.Config{Path: localDir, SharedPath: ".", Retries: 2}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"}); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Expected ErrIncomplete, got %v", err)
+	}
+	if fs.creates != 3 {
+		t.Errorf("Expected 3 attempts, got %d", fs.creates)
+	}
+	if fs.reconnects != 0 {
+		t.Errorf("Expected no reconnects for a sharing violation, got %d", fs.reconnects)
+	}
+}
+
+func TestSyncFiles_PermanentErrorNotRetried(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "alpha"})
+
+	fs := &flakyFS{RemoteFS: NewMemFS(), failures: 10, err: &os.PathError{Op: "open", Path: "a.bak", Err: os.ErrPermission}}
+	cfg := &config.Config{Path: localDir, SharedPath: ".", Retries: 5}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"}); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Expected ErrIncomplete, got %v", err)
+	}
+	if fs.creates != 1 {
+		t.Errorf("Expected a single attempt, got %d", fs.creates)
+	}
+}
+
+// droppingFS fails one upload after failAfter bytes with a connection reset.
+type droppingFS struct {
+	countingFS
+	failAfter int64
+	dropped   bool
+}
+
+type droppingFile struct {
+	RemoteFile
+	fs *droppingFS
+}
+
+func (d *droppingFS) Create(name string) (RemoteFile, error) {
+	f, err := d.countingFS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &droppingFile{RemoteFile: f, fs: d}, nil
+}
+
+func (f *droppingFile) Write(p []byte) (int, error) {
+	if !f.fs.dropped && f.fs.written+int64(len(p)) > f.fs.failAfter {
+		f.fs.dropped = true
+		n, _ := f.RemoteFile.Write(p[:f.fs.failAfter-f.fs.written])
+		return n, &net.OpError{Op: "write", Err: syscall.ECONNRESET}
+	}
+	return f.RemoteFile.Write(p)
+}
+
+func TestSyncFiles_RetryResumesPartialCopy(t *testing.T) {
+	localDir := t.TempDir()
+	content := make([]byte, 256<<10)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	writeTestFiles(t, localDir, map[string]string{"a.bak": string(content)})
+
+	fs := &droppingFS{countingFS: countingFS{RemoteFS: NewMemFS()}, failAfter: 64 << 10}
+	cfg := &config.Config{
+		Path:        localDir,
+		SharedPath:  ".",
+		Resume:      true,
+		ResumeState: filepath.Join(t.TempDir(), "resume.json"),
+		Retries:     1,
+	}
+	if err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"}); err != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+
+	if got := readRemoteFile(t, fs, "a.bak"); got != string(content) {
+		t.Error("Expected the resumed copy to match the source")
+	}
+	if fs.written != int64(len(content)) {
+		t.Errorf("Expected the retry to continue from the resume point (%d bytes written), got %d", len(content), fs.written)
+	}
+}
+
+func TestSession_ReconnectOnce(t *testing.T) {
+	cfg := &config.Config{TargetDir: t.TempDir()}
+	s, err := openSession(cfg)
+	if err != nil {
+		t.Fatalf("openSession failed: %v", err)
+	}
+	defer s.Close()
+
+	gen := s.generation()
+	if err := s.reconnect(gen); err != nil {
+		t.Fatalf("reconnect failed: %v", err)
+	}
+	if err := s.reconnect(gen); err != nil {
+		t.Fatalf("reconnect failed: %v", err)
+	}
+	if got := s.generation(); got != gen+1 {
+		t.Errorf("Expected a single reconnect for the same generation, got generation %d", got)
+	}
+	if _, err := s.Stat("."); err != nil {
+		t.Errorf("Expected the session to be usable after reconnecting, got %v", err)
+	}
+}
+
+func TestConnectWithRetry_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var dials int
+	s := &session{
+		ctx: ctx,
+		cfg: &config.Config{Retries: 3, RetryDelay: time.Hour},
+		dial: func(*config.Config) (RemoteFS, func(), error) {
+			dials++
+			return nil, nil, fmt.Errorf("%w: connection refused", ErrConnection)
+		},
+	}
+
+	start := time.Now()
+	_, _, err := s.connectWithRetry()
+	if !errors.Is(err, ErrInterrupted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected an interrupted connection, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the backoff to stop with the context, took %s", elapsed)
+	}
+	if dials != 1 {
+		t.Errorf("Expected a single attempt before the cancel, got %d", dials)
+	}
+}
+
+func TestSession_ReconnectDialsWithoutLock(t *testing.T) {
+	dialing, proceed := make(chan struct{}), make(chan struct{})
+	s := &session{
+		ctx: context.Background(),
+		cfg: &config.Config{},
+		fs:  NewMemFS(),
+		dial: func(*config.Config) (RemoteFS, func(), error) {
+			close(dialing)
+			<-proceed
+			return NewMemFS(), func() {}, nil
+		},
+	}
+
+	done := make(chan error)
+	go func() { done <- s.reconnect(0) }()
+	<-dialing
+
+	unblocked := make(chan struct{})
+	go func() {
+		s.Stat(".")
+		s.generation()
+		close(unblocked)
+	}()
+	select {
+	case <-unblocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the session to stay usable while dialing")
+	}
+
+	close(proceed)
+	if err := <-done; err != nil {
+		t.Fatalf("reconnect failed: %v", err)
+	}
+	if got := s.generation(); got != 1 {
+		t.Errorf("Expected generation 1 after reconnecting, got %d", got)
+	}
+}
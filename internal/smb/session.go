@@ -0,0 +1,160 @@
+package smb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+)
+
+// session is the destination of a run. It forwards every call to the current
+// connection and replaces that connection when it is lost, so workers keep
+// using the same RemoteFS across reconnects. ctx is the run the session
+// belongs to; once it is done, connection attempts stop waiting to retry.
+type session struct {
+	ctx  context.Context
+	cfg  *config.Config
+	dial func(*config.Config) (RemoteFS, func(), error)
+
+	// reconnecting lets a single worker dial while the others wait for it.
+	reconnecting sync.Mutex
+
+	mu      sync.RWMutex
+	fs      RemoteFS
+	release func()
+	gen     int
+	closed  bool
+}
+
+// openSession connects to the destination described by cfg, retrying
+// transient failures according to the retry policy.
+func openSession(cfg *config.Config) (*session, error) {
+	return openSessionContext(context.Background(), cfg)
+}
+
+// openSessionContext is openSession for a run that can be stopped: once ctx
+// is done, connection attempts stop waiting to retry.
+func openSessionContext(ctx context.Context, cfg *config.Config) (*session, error) {
+	s := &session{ctx: ctx, cfg: cfg, dial: connect}
+	fs, release, err := s.connectWithRetry()
+	if err != nil {
+		return nil, err
+	}
+	s.fs, s.release = fs, release
+	return s, nil
+}
+
+func (s *session) connectWithRetry() (RemoteFS, func(), error) {
+	policy := newRetryPolicy(s.cfg)
+	for n := 1; ; n++ {
+		fs, release, err := s.dial(s.cfg)
+		if err == nil {
+			return fs, release, nil
+		}
+		if classifyError(err) == errPermanent || n >= policy.attempts {
+			return nil, nil, err
+		}
+		wait := policy.backoff(n)
+		logger.Sugar.Warnf("Intento de conexión %d de %d falló: %v. Reintentando en %s", n, policy.attempts, err, wait.Round(time.Millisecond))
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			timer.Stop()
+			logger.Sugar.Warn("Reintento de conexión cancelado")
+			return nil, nil, fmt.Errorf("%w: %w", ErrInterrupted, s.ctx.Err())
+		}
+	}
+}
+
+func (s *session) generation() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.gen
+}
+
+// reconnect replaces the connection identified by gen. It does nothing if
+// another worker already replaced it. The new connection is dialed without
+// holding mu, so the backoff between attempts does not block Close or the
+// workers still failing on the lost connection.
+func (s *session) reconnect(gen int) error {
+	s.reconnecting.Lock()
+	defer s.reconnecting.Unlock()
+
+	s.mu.Lock()
+	if gen != s.gen {
+		s.mu.Unlock()
+		return nil
+	}
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("reconnect: session closed")
+	}
+	release := s.release
+	s.release = nil
+	s.mu.Unlock()
+
+	logger.Sugar.Info("Restableciendo la conexión con el destino")
+	if release != nil {
+		release()
+	}
+	fs, release, err := s.connectWithRetry()
+	if err != nil {
+		return fmt.Errorf("reconnect: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		release()
+		return errors.New("reconnect: session closed")
+	}
+	s.fs, s.release = fs, release
+	s.gen++
+	logger.Sugar.Info("Conexión restablecida")
+	return nil
+}
+
+// Close releases the current connection.
+func (s *session) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.release != nil {
+		s.release()
+		s.release = nil
+	}
+}
+
+func (s *session) current() RemoteFS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.fs
+}
+
+func (s *session) Create(name string) (RemoteFile, error) { return s.current().Create(name) }
+func (s *session) Open(name string) (RemoteFile, error)   { return s.current().Open(name) }
+func (s *session) Stat(name string) (os.FileInfo, error)  { return s.current().Stat(name) }
+func (s *session) Remove(name string) error               { return s.current().Remove(name) }
+func (s *session) Rename(oldname, newname string) error   { return s.current().Rename(oldname, newname) }
+
+func (s *session) OpenFile(name string, flag int, perm os.FileMode) (RemoteFile, error) {
+	return s.current().OpenFile(name, flag, perm)
+}
+
+func (s *session) MkdirAll(name string, perm os.FileMode) error {
+	return s.current().MkdirAll(name, perm)
+}
+
+func (s *session) Chtimes(name string, atime, mtime time.Time) error {
+	return s.current().Chtimes(name, atime, mtime)
+}
+
+func (s *session) ReadDir(name string) ([]os.FileInfo, error) {
+	return s.current().ReadDir(name)
+}
@@ -1,12 +1,24 @@
 package smb
 
 import (
+	"io/fs"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 
+	"github.com/hvarillas/smbsync/internal/config"
 	"github.com/hvarillas/smbsync/internal/logger"
 )
 
+// selectFiles returns the local files to sync, relative to cfg.Path.
+func selectFiles(cfg *config.Config) []string {
+	if cfg.Recursive {
+		return getRegexFilesRecursive(cfg.Regex, cfg.Path, cfg.MaxDepth, cfg.SkipHidden)
+	}
+	return getRegexFiles(cfg.Regex, cfg.Path)
+}
+
 func getRegexFiles(regex, path string) []string {
 	logger.Sugar.Debugf("Escaneando directorio '%s' con patrón regex: '%s'", path, regex)
 
@@ -38,3 +50,66 @@ func getRegexFiles(regex, path string) []string {
 
 	return matchingFiles
 }
+
+// getRegexFilesRecursive walks the tree under root and returns the files whose
+// slash-separated path relative to root matches regex. maxDepth limits how many
+// directory levels below root are visited (0 means unlimited) and skipHidden
+// prunes hidden and system directories.
+func getRegexFilesRecursive(regex, root string, maxDepth int, skipHidden bool) []string {
+	logger.Sugar.Debugf("Escaneando recursivamente '%s' con patrón regex: '%s' (profundidad máxima: %d)", root, regex, maxDepth)
+
+	re, err := regexp.Compile("(?i)" + regex)
+	if err != nil {
+		logger.Sugar.Errorf("Patrón regex inválido '%s': %v", regex, err)
+		return nil
+	}
+
+	var matchingFiles []string
+	err = filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			logger.Sugar.Warnf("No se pudo leer '%s': %v", p, err)
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if rel == "." {
+				return nil
+			}
+			if skipHidden && isHiddenDir(entry) {
+				logger.Sugar.Debugf("Omitiendo directorio oculto o de sistema: %s", rel)
+				return filepath.SkipDir
+			}
+			if maxDepth > 0 && strings.Count(rel, "/")+1 > maxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if entry.Type().IsRegular() && re.MatchString(rel) {
+			matchingFiles = append(matchingFiles, rel)
+			logger.Sugar.Debugf("Archivo encontrado: %s", rel)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Sugar.Errorf("Error al recorrer directorio local '%s': %v", root, err)
+		return nil
+	}
+
+	if len(matchingFiles) > 0 {
+		logger.Sugar.Infof("Encontrados %d archivos que coinciden con el patrón bajo '%s'", len(matchingFiles), root)
+	} else {
+		logger.Sugar.Warnf("No se encontraron archivos que coincidan con el patrón '%s' bajo '%s'", regex, root)
+	}
+
+	return matchingFiles
+}
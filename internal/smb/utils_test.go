@@ -147,3 +147,81 @@ func TestGetRegexFiles_EmptyDirectory(t *testing.T) {
 		t.Errorf("Expected empty result for empty directory, got %v", result)
 	}
 }
+
+func TestGetRegexFilesRecursive(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, file := range []string{
+		"top.bak",
+		"a/one.bak",
+		"a/b/two.bak",
+		"a/b/c/three.bak",
+		"a/readme.txt",
+		".hidden/secret.bak",
+		"logs/app.log",
+	} {
+		p := filepath.Join(tempDir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte("test content"), 0644); err != nil {
+			t.Fatalf("Failed to create test file %s: %v", file, err)
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		regex      string
+		maxDepth   int
+		skipHidden bool
+		expected   []string
+	}{
+		{
+			name:     "all bak files",
+			regex:    `\.bak$`,
+			expected: []string{"top.bak", "a/one.bak", "a/b/two.bak", "a/b/c/three.bak", ".hidden/secret.bak"},
+		},
+		{
+			name:       "skip hidden directories",
+			regex:      `\.bak$`,
+			skipHidden: true,
+			expected:   []string{"top.bak", "a/one.bak", "a/b/two.bak", "a/b/c/three.bak"},
+		},
+		{
+			name:       "max depth",
+			regex:      `\.bak$`,
+			maxDepth:   2,
+			skipHidden: true,
+			expected:   []string{"top.bak", "a/one.bak", "a/b/two.bak"},
+		},
+		{
+			name:     "regex applies to relative path",
+			regex:    `^a/b/`,
+			expected: []string{"a/b/two.bak", "a/b/c/three.bak"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := getRegexFilesRecursive(tc.regex, tempDir, tc.maxDepth, tc.skipHidden)
+
+			if len(result) != len(tc.expected) {
+				t.Fatalf("Expected %v, got %v", tc.expected, result)
+			}
+			resultMap := make(map[string]bool)
+			for _, file := range result {
+				resultMap[file] = true
+			}
+			for _, expected := range tc.expected {
+				if !resultMap[expected] {
+					t.Errorf("Expected file %s not found in result %v", expected, result)
+				}
+			}
+		})
+	}
+}
+
+func TestGetRegexFilesRecursive_NonexistentDirectory(t *testing.T) {
+	if result := getRegexFilesRecursive(`.*`, "/nonexistent/directory", 0, false); result != nil {
+		t.Errorf("Expected nil result for nonexistent directory, got %v", result)
+	}
+}
@@ -2,102 +2,280 @@ package smb
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"fmt"
+	"hash"
 	"io"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
-	"strings"
+	"slices"
 	"time"
 
-	"github.com/hirochachacha/go-smb2"
+	"github.com/hvarillas/smbsync/internal/checksum"
+	"github.com/hvarillas/smbsync/internal/config"
 	"github.com/hvarillas/smbsync/internal/logger"
-	"github.com/k0kubun/go-ansi"
-	"github.com/schollz/progressbar/v3"
 )
 
-func verifyIntegrity(fs *smb2.Share, remoteFilePath string, sourceHashSum []byte, fileName, localBasePath string, deleteAfter, zippy bool) error {
-	logger.Sugar.Info("Fase: Verificación de integridad SHA256")
-	
-	copiedFile, err := fs.Open(remoteFilePath)
+// sampleBlockSize is the size of the blocks compared in sample mode.
+const sampleBlockSize = 1 << 20
+
+// verifyIntegrity checks the remote copy at remoteFilePath as configured by
+// --verify. In full mode it rereads the copy and compares it with
+// sourceHashSum, returning the hash of the remote copy. In sample mode it
+// compares the copy with sample, which describes what was uploaded.
+func verifyIntegrity(job *syncJob, remoteFilePath string, sample sampleSource, sourceHashSum []byte, fileName string) ([]byte, error) {
+	switch job.cfg.VerifyMode {
+	case config.VerifyNone:
+		logger.Sugar.Warnf("Verificación desactivada: la copia de %s no se vuelve a leer", fileName)
+		return nil, nil
+	case config.VerifySample:
+		return nil, verifySample(job, remoteFilePath, sample, fileName)
+	}
+
+	logger.Sugar.Infof("Fase: Verificación de integridad %s", job.hasher.Name())
+
+	copiedFile, err := job.fs.Open(remoteFilePath)
 	if err != nil {
 		logger.Sugar.Errorf("Error al reabrir archivo remoto para verificación: %v", err)
-		return fmt.Errorf("could not reopen remote file for verification: %w", err)
+		return nil, fmt.Errorf("could not reopen remote file for verification: %w", err)
 	}
 
 	copiedFileInfo, err := copiedFile.Stat()
 	if err != nil {
 		copiedFile.Close()
 		logger.Sugar.Errorf("Error al obtener información del archivo remoto: %v", err)
-		return fmt.Errorf("could not get remote file info: %w", err)
+		return nil, fmt.Errorf("could not get remote file info: %w", err)
 	}
 
-	bar := progressbar.NewOptions64(
-		copiedFileInfo.Size(),
-		progressbar.OptionSetDescription("Calculando Hash..."),
-		progressbar.OptionSetWriter(ansi.NewAnsiStdout()),
-		progressbar.OptionShowBytes(true),
-		progressbar.OptionSetWidth(40),
-		progressbar.OptionThrottle(100*time.Millisecond),
-		progressbar.OptionShowCount(),
-		progressbar.OptionClearOnFinish(),
-		progressbar.OptionEnableColorCodes(true),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "[green]█[reset]",
-			SaucerHead:    "[green]█[reset]",
-			SaucerPadding: "░",
-			BarStart:      "|",
-			BarEnd:        "|",
-		}),
-	)
-
-	destHash := sha256.New()
-	if _, err := io.Copy(io.MultiWriter(destHash, bar), copiedFile); err != nil {
-		copiedFile.Close()
-		logger.Sugar.Errorf("Error al calcular hash del archivo remoto: %v", err)
-		return fmt.Errorf("failed to calculate remote file hash: %w", err)
-	}
+	defer copiedFile.Close()
+	return verifyHash(job, job.limiter.Reader(copiedFile), copiedFileInfo.Size(), sourceHashSum, fileName)
+}
+
+// verifyHash hashes the copy read from copied and compares it with the hash
+// computed from the source while it was being transferred. It returns the
+// hash of the copy.
+func verifyHash(job *syncJob, copied io.Reader, size int64, sourceHashSum []byte, fileName string) ([]byte, error) {
+	bar := job.phaseProgress(size, "Calculando Hash...")
 
-	copiedFile.Close()
+	destHash := job.hasher.New()
+	if _, err := io.Copy(io.MultiWriter(destHash, bar), copied); err != nil {
+		logger.Sugar.Errorf("Error al calcular hash del archivo destino: %v", err)
+		return nil, fmt.Errorf("failed to calculate destination file hash: %w", err)
+	}
 
 	destHashSum := destHash.Sum(nil)
-	logger.Sugar.Debugf("Hash SHA256 del archivo destino: %x", destHashSum)
+	logger.Sugar.Debugf("Hash %s del archivo destino: %x", job.hasher.Name(), destHashSum)
 
 	if !bytes.Equal(sourceHashSum, destHashSum) {
 		logger.Sugar.Errorf("¡FALLO DE INTEGRIDAD! Los hashes no coinciden para %s", fileName)
 		logger.Sugar.Errorf("Hash origen: %x", sourceHashSum)
 		logger.Sugar.Errorf("Hash destino: %x", destHashSum)
-		return fmt.Errorf("hash mismatch: file corruption likely")
+		return destHashSum, errHashMismatch
 	}
 
 	logger.Sugar.Infof("✅ Archivo %s copiado y verificado exitosamente", fileName)
-	logger.Sugar.Debugf("Verificación SHA256 exitosa - Hashes coinciden: %x", sourceHashSum)
-
-	if deleteAfter {
-		time.Sleep(100 * time.Millisecond)
-		
-		originalFileToDelete := filepath.Join(localBasePath, fileName)
-		logger.Sugar.Infof("Eliminando archivo local original: %s", originalFileToDelete)
-		if err := os.Remove(originalFileToDelete); err != nil {
-			logger.Sugar.Errorf("Fallo al eliminar el archivo local original %s: %v", originalFileToDelete, err)
-			return fmt.Errorf("failed to delete local file: %w", err)
+	logger.Sugar.Debugf("Verificación %s exitosa - Hashes coinciden: %x", job.hasher.Name(), sourceHashSum)
+	return destHashSum, nil
+}
+
+// sampleSource is what sample mode compares a copy with: the size the copy
+// must have and the hash of each of its blocks.
+type sampleSource interface {
+	size() (int64, error)
+	blockSum(off, n int64) ([]byte, error)
+}
+
+// localBlocks samples the local file that was uploaded as it is.
+type localBlocks struct {
+	path   string
+	hasher checksum.Hasher
+}
+
+func (l localBlocks) size() (int64, error) {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return 0, fmt.Errorf("could not get local file info: %w", err)
+	}
+	return info.Size(), nil
+}
+
+func (l localBlocks) blockSum(off, n int64) ([]byte, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		logger.Sugar.Errorf("Error al reabrir archivo local para verificación: %v", err)
+		return nil, fmt.Errorf("could not reopen local file for verification: %w", err)
+	}
+	defer f.Close()
+	return hashReader(l.hasher, io.NewSectionReader(f, off, n))
+}
+
+// blockSums records the hash of every sampleBlockSize block of a stream while
+// it is written, so a copy that only exists on the share, such as a
+// compressed stream, can still be sampled.
+type blockSums struct {
+	hasher  checksum.Hasher
+	current hash.Hash
+	written int64
+	sums    [][]byte
+}
+
+func newBlockSums(hasher checksum.Hasher) *blockSums {
+	return &blockSums{hasher: hasher}
+}
+
+func (b *blockSums) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if b.current == nil {
+			b.current = b.hasher.New()
+		}
+		chunk := p[:min(int64(len(p)), sampleBlockSize-b.written%sampleBlockSize)]
+		b.current.Write(chunk)
+		b.written += int64(len(chunk))
+		p = p[len(chunk):]
+		if b.written%sampleBlockSize == 0 {
+			b.sums = append(b.sums, b.current.Sum(nil))
+			b.current = nil
+		}
+	}
+	return n, nil
+}
+
+func (b *blockSums) size() (int64, error) {
+	return b.written, nil
+}
+
+func (b *blockSums) blockSum(off, n int64) ([]byte, error) {
+	if off%sampleBlockSize == 0 {
+		i := int(off / sampleBlockSize)
+		if i < len(b.sums) {
+			return b.sums[i], nil
+		}
+		if i == len(b.sums) && b.current != nil {
+			return b.current.Sum(nil), nil
+		}
+	}
+	return nil, fmt.Errorf("no block recorded at %d", off)
+}
+
+// verifySample compares the size of the remote copy with sample and the hash
+// of some of their blocks, read with ReadAt: the first, the last and others
+// chosen at random. It reads a small part of the copy, so it catches
+// truncated or misplaced writes but not every corrupted byte.
+func verifySample(job *syncJob, remoteFilePath string, sample sampleSource, fileName string) error {
+	logger.Sugar.Infof("Fase: Verificación por muestreo %s", job.hasher.Name())
+
+	remoteFile, err := job.fs.Open(remoteFilePath)
+	if err != nil {
+		logger.Sugar.Errorf("Error al reabrir archivo remoto para verificación: %v", err)
+		return fmt.Errorf("could not reopen remote file for verification: %w", err)
+	}
+	defer remoteFile.Close()
+
+	remoteInfo, err := remoteFile.Stat()
+	if err != nil {
+		logger.Sugar.Errorf("Error al obtener información del archivo remoto: %v", err)
+		return fmt.Errorf("could not get remote file info: %w", err)
+	}
+	size, err := sample.size()
+	if err != nil {
+		return err
+	}
+
+	if remoteInfo.Size() != size {
+		logger.Sugar.Errorf("¡FALLO DE INTEGRIDAD! La copia de %s tiene %d bytes y el original %d", fileName, remoteInfo.Size(), size)
+		return errHashMismatch
+	}
+
+	samples := job.cfg.VerifySamples
+	if samples <= 0 {
+		samples = config.DefaultVerifySamples
+	}
+	offsets := sampleOffsets(size, sampleBlockSize, samples)
+	for _, off := range offsets {
+		n := min(sampleBlockSize, size-off)
+		remoteSum, err := hashReader(job.hasher, job.limiter.Reader(io.NewSectionReader(remoteFile, off, n)))
+		if err != nil {
+			logger.Sugar.Errorf("Error al leer el bloque en el byte %d de la copia de %s: %v", off, fileName, err)
+			return fmt.Errorf("could not read remote block at %d: %w", off, err)
 		}
-		logger.Sugar.Infof("Archivo local original %s eliminado.", originalFileToDelete)
-		
-		if zippy {
-			zipFilePath := filepath.Join(localBasePath, strings.TrimSuffix(fileName, filepath.Ext(fileName))+".zip")
-			if zipFilePath != originalFileToDelete {
-				if _, err := os.Stat(zipFilePath); err == nil {
-					logger.Sugar.Infof("Eliminando archivo zip temporal: %s", zipFilePath)
-					if err := os.Remove(zipFilePath); err != nil {
-						logger.Sugar.Errorf("Fallo al eliminar el archivo zip temporal %s: %v", zipFilePath, err)
-					} else {
-						logger.Sugar.Infof("Archivo zip temporal %s eliminado.", zipFilePath)
-					}
-				}
-			}
+		localSum, err := sample.blockSum(off, n)
+		if err != nil {
+			return fmt.Errorf("could not read local block at %d: %w", off, err)
+		}
+		if !bytes.Equal(remoteSum, localSum) {
+			logger.Sugar.Errorf("¡FALLO DE INTEGRIDAD! El bloque en el byte %d de %s no coincide", off, fileName)
+			return errHashMismatch
 		}
 	}
 
+	logger.Sugar.Infof("✅ Archivo %s copiado y verificado por muestreo (%d bloques)", fileName, len(offsets))
+	return nil
+}
+
+// sampleOffsets returns the sorted offsets of up to n blocks of a file of the
+// given size: the first, the last and the rest at random. Files with n blocks
+// or fewer are covered completely.
+func sampleOffsets(size, block int64, n int) []int64 {
+	blocks := (size + block - 1) / block
+	picked := map[int64]bool{}
+	if blocks <= int64(n) {
+		for i := int64(0); i < blocks; i++ {
+			picked[i] = true
+		}
+	} else {
+		picked[0] = true
+		if n > 1 {
+			picked[blocks-1] = true
+		}
+		for len(picked) < n {
+			picked[rand.Int64N(blocks)] = true
+		}
+	}
+
+	offsets := make([]int64, 0, len(picked))
+	for i := range picked {
+		offsets = append(offsets, i*block)
+	}
+	slices.Sort(offsets)
+	return offsets
+}
+
+func hashReader(hasher checksum.Hasher, r io.Reader) ([]byte, error) {
+	h := hasher.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// deleteLocal removes the local original once the remote copy has been
+// verified and moved to its final name, and reports whether it did. With
+// local retention the original is only marked as verified; pruneLocal
+// decides at the end of the run whether it goes.
+func deleteLocal(job *syncJob, fileName string) (bool, error) {
+	if !job.cfg.DeleteAfter {
+		return false, nil
+	}
+	if job.localKeep.Enabled() {
+		job.mu.Lock()
+		job.verifiedLocal[fileName] = true
+		job.mu.Unlock()
+		return false, nil
+	}
+	return true, removeLocal(job, fileName)
+}
+
+// removeLocal deletes the local original of fileName.
+func removeLocal(job *syncJob, fileName string) error {
+	time.Sleep(100 * time.Millisecond)
+
+	originalFileToDelete := filepath.Join(job.cfg.Path, fileName)
+	logger.Sugar.Infof("Eliminando archivo local original: %s", originalFileToDelete)
+	if err := os.Remove(originalFileToDelete); err != nil {
+		logger.Sugar.Errorf("Fallo al eliminar el archivo local original %s: %v", originalFileToDelete, err)
+		return fmt.Errorf("failed to delete local file: %w", err)
+	}
+	logger.Sugar.Infof("Archivo local original %s eliminado.", originalFileToDelete)
 	return nil
 }
@@ -0,0 +1,86 @@
+package smb
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hvarillas/smbsync/internal/config"
+)
+
+func TestSampleOffsets(t *testing.T) {
+	testCases := []struct {
+		name string
+		size int64
+		n    int
+		want int
+	}{
+		{"empty", 0, 4, 0},
+		{"smaller than a block", 10, 4, 1},
+		{"fewer blocks than samples", 35, 4, 4},
+		{"more blocks than samples", 1000, 4, 4},
+		{"single sample", 1000, 1, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			offsets := sampleOffsets(tc.size, 10, tc.n)
+			if len(offsets) != tc.want {
+				t.Fatalf("Expected %d offsets, got %v", tc.want, offsets)
+			}
+			if !slices.IsSorted(offsets) || len(slices.Compact(slices.Clone(offsets))) != len(offsets) {
+				t.Errorf("Expected sorted distinct offsets, got %v", offsets)
+			}
+			if tc.want > 0 && offsets[0] != 0 {
+				t.Errorf("Expected the first block, got %v", offsets)
+			}
+			if tc.want > 1 && offsets[len(offsets)-1] != (tc.size-1)/10*10 {
+				t.Errorf("Expected the last block, got %v", offsets)
+			}
+		})
+	}
+}
+
+func TestSyncFiles_VerifyModes(t *testing.T) {
+	testCases := []struct {
+		mode    string
+		corrupt bool
+		wantErr bool
+	}{
+		{config.VerifyFull, true, true},
+		{config.VerifySample, false, false},
+		{config.VerifySample, true, true},
+		{config.VerifyNone, true, false},
+	}
+
+	for _, tc := range testCases {
+		name := tc.mode
+		if tc.corrupt {
+			name += " corrupt"
+		}
+		t.Run(name, func(t *testing.T) {
+			localDir := t.TempDir()
+			// Several sample blocks, so the sampled reads use ReadAt offsets.
+			writeTestFiles(t, localDir, map[string]string{"a.bak": strings.Repeat("x", 3*sampleBlockSize+1)})
+			fs := &faultyFS{RemoteFS: NewMemFS(), corrupt: tc.corrupt}
+			reportPath := filepath.Join(t.TempDir(), "run.json")
+			cfg := &config.Config{Path: localDir, SharedPath: ".", VerifyMode: tc.mode, VerifySamples: 2, Report: reportPath}
+
+			err := syncFiles(context.Background(), fs, cfg, []string{"a.bak"})
+			if tc.wantErr != errors.Is(err, ErrIncomplete) {
+				t.Fatalf("Expected failure %v, got %v", tc.wantErr, err)
+			}
+
+			r := readReport(t, reportPath)
+			if r.VerifyMode != tc.mode {
+				t.Errorf("Expected verify mode %s in the report, got %q", tc.mode, r.VerifyMode)
+			}
+			if tc.mode != config.VerifyFull && r.Files[0].DestHash != "" {
+				t.Errorf("Expected no destination hash without a full reread, got %s", r.Files[0].DestHash)
+			}
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package smb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hvarillas/smbsync/internal/config"
+	"github.com/hvarillas/smbsync/internal/logger"
+)
+
+// Defaults for watch mode when the configuration leaves them unset.
+const (
+	defaultStableFor = 10 * time.Second
+	defaultKeepalive = time.Minute
+	// maxRetryWait caps the wait before a file whose copy failed is tried
+	// again.
+	maxRetryWait = 15 * time.Minute
+)
+
+// candidate is a file seen by the watcher that is not yet known to be
+// complete.
+type candidate struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// fileState identifies a version of a file that was already handled.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// watcher turns file system events under cfg.Path into copies once each file
+// has stopped changing.
+type watcher struct {
+	cfg *config.Config
+	job *syncJob
+	re  *regexp.Regexp
+
+	fsw     *fsnotify.Watcher
+	pending map[string]*candidate
+	ready   chan string
+
+	mu       sync.Mutex
+	inflight map[string]bool
+	done     map[string]fileState
+	// known holds every matching file seen under cfg.Path, which local
+	// retention ranks without scanning the tree again.
+	known map[string]bool
+	// failures counts the consecutive failed copies of each file, and
+	// requeue holds the failed files until the loop moves them back to
+	// pending, with the time their stability window starts again.
+	failures map[string]int
+	requeue  map[string]time.Time
+	// pruneMu keeps workers from applying local retention at the same time.
+	pruneMu sync.Mutex
+}
+
+// RunWatch watches cfg.Path and copies every file matching cfg.Regex as soon
+// as it has been stable for cfg.StableFor and is not locked by its writer.
+// Files already present are handled first. The destination connection is
+// kept alive and re-established when it drops. It returns when ctx is done.
+func RunWatch(ctx context.Context, cfg *config.Config) error {
+	re, err := regexp.Compile("(?i)" + cfg.Regex)
+	if err != nil {
+		return fmt.Errorf("invalid regex %q: %w", cfg.Regex, err)
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("could not start file watcher: %w", err)
+	}
+	defer fsw.Close()
+
+	sess, err := openSessionContext(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	job := newSyncJob(ctx, sess, cfg, "watch")
+	job.report = nil
+	job.journal = openJournal(cfg)
+
+	w := &watcher{
+		cfg:      cfg,
+		job:      job,
+		re:       re,
+		fsw:      fsw,
+		pending:  map[string]*candidate{},
+		ready:    make(chan string),
+		inflight: map[string]bool{},
+		done:     map[string]fileState{},
+		known:    map[string]bool{},
+		failures: map[string]int{},
+		requeue:  map[string]time.Time{},
+	}
+	if err := w.addTree(cfg.Path); err != nil {
+		return fmt.Errorf("could not watch %s: %w", cfg.Path, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(cfg.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range w.ready {
+				w.process(file)
+			}
+		}()
+	}
+	defer func() {
+		close(w.ready)
+		wg.Wait()
+	}()
+
+	logger.Sugar.Infof("Vigilando %s (archivos estables durante %s)", cfg.Path, w.stableFor())
+	w.scan()
+	return w.loop(ctx, sess)
+}
+
+func (w *watcher) stableFor() time.Duration {
+	if w.cfg.StableFor > 0 {
+		return w.cfg.StableFor
+	}
+	return defaultStableFor
+}
+
+func (w *watcher) loop(ctx context.Context, sess *session) error {
+	tick := time.NewTicker(min(w.stableFor()/4+time.Millisecond, time.Second))
+	defer tick.Stop()
+
+	keepalive := w.cfg.Keepalive
+	if keepalive <= 0 {
+		keepalive = defaultKeepalive
+	}
+	ping := time.NewTicker(keepalive)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Sugar.Info("Deteniendo el modo de vigilancia")
+			return nil
+
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return errors.New("file watcher stopped")
+			}
+			w.handle(event)
+
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return errors.New("file watcher stopped")
+			}
+			logger.Sugar.Warnf("Error del vigilante de archivos: %v", err)
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.scan()
+			}
+
+		case now := <-tick.C:
+			w.dispatchStable(now)
+
+		case <-ping.C:
+			w.keepalive(sess)
+		}
+	}
+}
+
+// addTree watches dir and, in recursive mode, every subdirectory that the
+// depth and hidden-directory settings allow.
+func (w *watcher) addTree(dir string) error {
+	if !w.cfg.Recursive {
+		return w.fsw.Add(dir)
+	}
+	return filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir {
+				return err
+			}
+			logger.Sugar.Warnf("No se pudo leer '%s': %v", p, err)
+			return nil
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if rel := w.rel(p); rel != "." && !w.watchDir(rel, entry) {
+			return filepath.SkipDir
+		}
+		if err := w.fsw.Add(p); err != nil {
+			logger.Sugar.Warnf("No se pudo vigilar el directorio '%s': %v", p, err)
+		}
+		return nil
+	})
+}
+
+func (w *watcher) watchDir(rel string, entry fs.DirEntry) bool {
+	if w.cfg.SkipHidden && isHiddenDir(entry) {
+		return false
+	}
+	return w.cfg.MaxDepth <= 0 || strings.Count(rel, "/")+1 <= w.cfg.MaxDepth
+}
+
+func (w *watcher) rel(p string) string {
+	rel, err := filepath.Rel(w.cfg.Path, p)
+	if err != nil {
+		return p
+	}
+	return filepath.ToSlash(rel)
+}
+
+// scan picks up files that already exist or whose events were lost.
+func (w *watcher) scan() {
+	for _, file := range selectFiles(w.cfg) {
+		w.track(file)
+	}
+}
+
+func (w *watcher) handle(event fsnotify.Event) {
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		w.mu.Lock()
+		delete(w.known, w.rel(event.Name))
+		w.mu.Unlock()
+		return
+	}
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) && !event.Has(fsnotify.Chmod) {
+		return
+	}
+
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		return
+	}
+	rel := w.rel(event.Name)
+
+	if info.IsDir() {
+		if w.cfg.Recursive && event.Has(fsnotify.Create) && w.watchDir(rel, fs.FileInfoToDirEntry(info)) {
+			logger.Sugar.Debugf("Nuevo directorio vigilado: %s", rel)
+			if err := w.addTree(event.Name); err != nil {
+				logger.Sugar.Warnf("No se pudo vigilar el directorio '%s': %v", rel, err)
+			}
+			// Files may have been written before the watch was added.
+			for _, file := range selectFiles(w.cfg) {
+				if strings.HasPrefix(file, rel+"/") {
+					w.track(file)
+				}
+			}
+		}
+		return
+	}
+
+	if info.Mode().IsRegular() && w.re.MatchString(rel) {
+		w.track(rel)
+	}
+}
+
+// track starts or restarts the stability window of file.
+func (w *watcher) track(file string) {
+	info, err := os.Stat(filepath.Join(w.cfg.Path, file))
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+
+	w.mu.Lock()
+	w.known[file] = true
+	handled := w.inflight[file] || w.done[file] == fileState{info.Size(), info.ModTime()}
+	w.mu.Unlock()
+	if handled {
+		return
+	}
+
+	if c, ok := w.pending[file]; ok && c.size == info.Size() && c.modTime.Equal(info.ModTime()) {
+		return
+	}
+	if _, ok := w.pending[file]; !ok {
+		logger.Sugar.Infof("Archivo detectado: %s, esperando a que termine de escribirse", file)
+	}
+	w.pending[file] = &candidate{size: info.Size(), modTime: info.ModTime(), since: time.Now()}
+}
+
+// dispatchStable hands every file that has not changed for the stability
+// window, and is not locked, to the workers. Files whose copy failed are
+// tracked again first. Once every worker is busy, the remaining files stay
+// pending until the next tick, so the loop keeps handling events.
+func (w *watcher) dispatchStable(now time.Time) {
+	w.mu.Lock()
+	requeue := w.requeue
+	w.requeue = map[string]time.Time{}
+	w.mu.Unlock()
+	for file, since := range requeue {
+		info, err := os.Stat(filepath.Join(w.cfg.Path, file))
+		if _, ok := w.pending[file]; ok || err != nil {
+			continue
+		}
+		w.pending[file] = &candidate{size: info.Size(), modTime: info.ModTime(), since: since}
+	}
+
+	for file, c := range w.pending {
+		path := filepath.Join(w.cfg.Path, file)
+		info, err := os.Stat(path)
+		if err != nil {
+			delete(w.pending, file)
+			continue
+		}
+		if info.Size() != c.size || !info.ModTime().Equal(c.modTime) {
+			c.size, c.modTime, c.since = info.Size(), info.ModTime(), now
+			continue
+		}
+		if now.Sub(c.since) < w.stableFor() {
+			continue
+		}
+		if isLocked(path) {
+			logger.Sugar.Debugf("Archivo %s bloqueado por otro proceso, se espera", file)
+			c.since = now
+			continue
+		}
+
+		w.mu.Lock()
+		w.inflight[file] = true
+		w.mu.Unlock()
+
+		select {
+		case w.ready <- file:
+			delete(w.pending, file)
+		default:
+			w.mu.Lock()
+			delete(w.inflight, file)
+			w.mu.Unlock()
+			return
+		}
+	}
+}
+
+// process copies one stable file and remembers the version it handled. A
+// file that fails is queued again, waiting longer after each failure.
+func (w *watcher) process(file string) {
+	info, statErr := os.Stat(filepath.Join(w.cfg.Path, file))
+	err := w.job.copyFile(file)
+	w.job.flushManifests()
+	if err == nil && w.job.localKeep.Enabled() {
+		w.pruneMu.Lock()
+		w.job.pruneLocal(w.knownFiles())
+		w.pruneMu.Unlock()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.inflight, file)
+	if err != nil {
+		w.failures[file]++
+		wait := w.retryWait(w.failures[file])
+		logger.Sugar.Warnf("Se reintentará la copia de %s en %s", file, wait)
+		// The file is dispatched once its stability window, started so that
+		// it ends after wait, has passed.
+		w.requeue[file] = time.Now().Add(wait - w.stableFor())
+		return
+	}
+	delete(w.failures, file)
+	if statErr == nil {
+		w.done[file] = fileState{info.Size(), info.ModTime()}
+	}
+}
+
+// knownFiles lists the matching files seen under cfg.Path.
+func (w *watcher) knownFiles() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Sorted(maps.Keys(w.known))
+}
+
+// retryWait returns how long to wait before copying a file again after its
+// given consecutive failure: the stability window, doubled on every failure
+// up to maxRetryWait.
+func (w *watcher) retryWait(failures int) time.Duration {
+	wait := w.stableFor()
+	for i := 1; i < failures && wait < maxRetryWait; i++ {
+		wait *= 2
+	}
+	return min(wait, maxRetryWait)
+}
+
+// keepalive checks the destination connection and re-establishes it if it
+// was lost while idle.
+func (w *watcher) keepalive(sess *session) {
+	gen := sess.generation()
+	_, err := sess.Stat(w.cfg.SharedPath)
+	if err == nil || classifyError(err) == errPermanent {
+		return
+	}
+	logger.Sugar.Warnf("Conexión con el destino perdida: %v", err)
+	if err := sess.reconnect(gen); err != nil {
+		logger.Sugar.Errorf("No se pudo restablecer la conexión: %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package smb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hvarillas/smbsync/internal/config"
+)
+
+func TestRunWatch_CopiesNewFiles(t *testing.T) {
+	localDir := t.TempDir()
+	targetDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{
+		"existing.bak": "before",
+		"notes.txt":    "ignored",
+	})
+
+	cfg := &config.Config{
+		Regex:      `\.bak$`,
+		Path:       localDir,
+		SharedPath: ".",
+		TargetDir:  targetDir,
+		Recursive:  true,
+		StableFor:  100 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- RunWatch(ctx, cfg) }()
+
+	waitForFile(t, filepath.Join(targetDir, "existing.bak"), "before")
+
+	writeTestFiles(t, localDir, map[string]string{"new.bak": "after"})
+	waitForFile(t, filepath.Join(targetDir, "new.bak"), "after")
+
+	writeTestFiles(t, localDir, map[string]string{"sub/deep.bak": "nested"})
+	waitForFile(t, filepath.Join(targetDir, "sub", "deep.bak"), "nested")
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected RunWatch to stop cleanly, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunWatch did not stop after cancel")
+	}
+
+	if _, err := os.Stat(filepath.Join(targetDir, "notes.txt")); !os.IsNotExist(err) {
+		t.Error("Files not matching the regex must not be copied")
+	}
+}
+
+func waitForFile(t *testing.T, path, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if content, err := os.ReadFile(path); err == nil && string(content) == want {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Expected %s with content %q", path, want)
+}
+
+func newTestWatcher(cfg *config.Config) *watcher {
+	return &watcher{
+		cfg:      cfg,
+		job:      &syncJob{ctx: context.Background(), cfg: cfg},
+		re:       regexp.MustCompile(cfg.Regex),
+		pending:  map[string]*candidate{},
+		ready:    make(chan string, 10),
+		inflight: map[string]bool{},
+		done:     map[string]fileState{},
+		known:    map[string]bool{},
+		failures: map[string]int{},
+		requeue:  map[string]time.Time{},
+	}
+}
+
+func TestWatcher_DispatchStable(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"data.bak": "partial"})
+	w := newTestWatcher(&config.Config{Regex: `\.bak$`, Path: localDir, StableFor: time.Minute})
+
+	w.track("data.bak")
+	start := w.pending["data.bak"].since
+
+	w.dispatchStable(start.Add(30 * time.Second))
+	if len(w.ready) != 0 {
+		t.Fatal("Expected file to wait for the stability window")
+	}
+
+	// The file keeps growing: the window starts over.
+	writeTestFiles(t, localDir, map[string]string{"data.bak": "partial and more"})
+	w.dispatchStable(start.Add(90 * time.Second))
+	if len(w.ready) != 0 {
+		t.Fatal("Expected a changed file to restart the stability window")
+	}
+
+	w.dispatchStable(start.Add(150 * time.Second))
+	if len(w.ready) != 1 || <-w.ready != "data.bak" {
+		t.Fatal("Expected data.bak to be ready once stable")
+	}
+	if !w.inflight["data.bak"] || len(w.pending) != 0 {
+		t.Errorf("Expected data.bak to move from pending to inflight, got pending=%v inflight=%v", w.pending, w.inflight)
+	}
+
+	// Events for a file being copied are ignored.
+	w.track("data.bak")
+	if len(w.pending) != 0 {
+		t.Error("Expected inflight file not to be tracked again")
+	}
+}
+
+func TestWatcher_DispatchStableDoesNotBlock(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "a", "b.bak": "b"})
+	w := newTestWatcher(&config.Config{Regex: `\.bak$`, Path: localDir, StableFor: time.Second})
+	w.ready = make(chan string)
+
+	w.track("a.bak")
+	w.track("b.bak")
+	w.dispatchStable(time.Now().Add(time.Minute))
+	if len(w.pending) != 2 || len(w.inflight) != 0 {
+		t.Errorf("Expected both files to stay pending while workers are busy, got pending=%v inflight=%v", w.pending, w.inflight)
+	}
+}
+
+func TestWatcher_KnownFiles(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"a.bak": "a", "b.bak": "b"})
+	w := newTestWatcher(&config.Config{Regex: `\.bak$`, Path: localDir})
+
+	w.scan()
+	w.handle(fsnotify.Event{Name: filepath.Join(localDir, "a.bak"), Op: fsnotify.Remove})
+	if got := w.knownFiles(); len(got) != 1 || got[0] != "b.bak" {
+		t.Errorf("Expected only b.bak to be known, got %v", got)
+	}
+}
+
+func TestWatcher_SkipsHandledVersion(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"data.bak": "v1"})
+	w := newTestWatcher(&config.Config{Regex: `\.bak$`, Path: localDir})
+
+	info, err := os.Stat(filepath.Join(localDir, "data.bak"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.done["data.bak"] = fileState{info.Size(), info.ModTime()}
+
+	w.track("data.bak")
+	if len(w.pending) != 0 {
+		t.Error("Expected an already copied version to be ignored")
+	}
+
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(localDir, "data.bak"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	w.track("data.bak")
+	if _, ok := w.pending["data.bak"]; !ok {
+		t.Error("Expected a modified file to be tracked again")
+	}
+}
+
+func TestWatcher_RequeuesFailedCopy(t *testing.T) {
+	localDir := t.TempDir()
+	writeTestFiles(t, localDir, map[string]string{"data.bak": "content"})
+	cfg := &config.Config{Regex: `\.bak$`, Path: localDir, SharedPath: ".", StableFor: time.Minute}
+	fs := &faultyFS{RemoteFS: NewMemFS(), failAfter: 1}
+	w := newTestWatcher(cfg)
+	w.job = newSyncJob(context.Background(), fs, cfg, "watch")
+	w.job.report = nil
+
+	w.track("data.bak")
+	w.dispatchStable(time.Now().Add(2 * time.Minute))
+	w.process(<-w.ready)
+	if len(w.inflight) != 0 || w.failures["data.bak"] != 1 {
+		t.Fatalf("Expected one failure and nothing inflight, got failures=%v inflight=%v", w.failures, w.inflight)
+	}
+
+	// The first retry waits one stability window.
+	w.dispatchStable(time.Now().Add(30 * time.Second))
+	if len(w.ready) != 0 {
+		t.Fatal("Expected the failed file to wait before being retried")
+	}
+	fs.failAfter = 0
+	w.dispatchStable(time.Now().Add(2 * time.Minute))
+	if len(w.ready) != 1 {
+		t.Fatal("Expected the failed file to be dispatched again")
+	}
+	w.process(<-w.ready)
+
+	if got := readRemoteFile(t, fs, "data.bak"); got != "content" {
+		t.Errorf("Expected the retried copy on the share, got %q", got)
+	}
+	if len(w.failures) != 0 || len(w.requeue) != 0 {
+		t.Errorf("Expected the failure to be forgotten, got failures=%v requeue=%v", w.failures, w.requeue)
+	}
+}
+
+func TestWatcher_RetryWait(t *testing.T) {
+	w := newTestWatcher(&config.Config{StableFor: time.Minute})
+	for failures, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 4: 8 * time.Minute, 5: maxRetryWait, 50: maxRetryWait} {
+		if got := w.retryWait(failures); got != want {
+			t.Errorf("Expected %s after %d failures, got %s", want, failures, got)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package throttle
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter caps the combined throughput of every reader and writer it wraps.
+// It is safe for concurrent use, so a single Limiter shared by all workers
+// bounds the total bandwidth of a run. A nil Limiter does not limit.
+type Limiter struct {
+	rate     float64
+	schedule *Schedule
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// New returns a Limiter for bytesPerSec. When schedule is not nil the limit
+// only applies inside its windows.
+func New(bytesPerSec int64, schedule *Schedule) *Limiter {
+	return &Limiter{
+		rate:     float64(bytesPerSec),
+		schedule: schedule,
+		tokens:   float64(bytesPerSec),
+		now:      time.Now,
+		sleep:    time.Sleep,
+	}
+}
+
+// burst is the largest amount of bytes accounted for in one step.
+func (l *Limiter) burst() int {
+	if l.rate < 1 {
+		return 1
+	}
+	return int(l.rate)
+}
+
+// Wait blocks until n bytes may be transferred.
+func (l *Limiter) Wait(n int) {
+	if l == nil || l.rate <= 0 {
+		return
+	}
+	for n > 0 {
+		now := l.now()
+		if l.schedule != nil && !l.schedule.Active(now) {
+			return
+		}
+
+		chunk := min(n, l.burst())
+		l.mu.Lock()
+		if !l.last.IsZero() {
+			l.tokens += now.Sub(l.last).Seconds() * l.rate
+			if l.tokens > l.rate {
+				l.tokens = l.rate
+			}
+		}
+		l.last = now
+		l.tokens -= float64(chunk)
+		deficit := -l.tokens
+		l.mu.Unlock()
+
+		if deficit > 0 {
+			l.sleep(time.Duration(deficit / l.rate * float64(time.Second)))
+		}
+		n -= chunk
+	}
+}
+
+// Reader limits the bytes read from r.
+func (l *Limiter) Reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{r: r, l: l}
+}
+
+// Writer limits the bytes written to w.
+func (l *Limiter) Writer(w io.Writer) io.Writer {
+	if l == nil {
+		return w
+	}
+	return &writer{w: w, l: l}
+}
+
+type reader struct {
+	r io.Reader
+	l *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > r.l.burst() {
+		p = p[:r.l.burst()]
+	}
+	n, err := r.r.Read(p)
+	r.l.Wait(n)
+	return n, err
+}
+
+type writer struct {
+	w io.Writer
+	l *Limiter
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	w.l.Wait(len(p))
+	return w.w.Write(p)
+}
+
+// ParseRate parses a rate in bytes per second such as "512K", "10M",
+// "1.5MB" or "2000000". Suffixes are binary (K = 1024 bytes). A positive rate
+// that rounds down to 0 bytes per second is rejected.
+func ParseRate(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "/S"), "B")
+
+	mult := 1.0
+	if v != "" {
+		switch v[len(v)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		}
+		if mult > 1 {
+			v = v[:len(v)-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	rate := int64(n * mult)
+	if rate == 0 && n > 0 {
+		// 0 means no limit, which is the opposite of what was asked for.
+		return 0, fmt.Errorf("rate %q is below 1 byte per second", s)
+	}
+	return rate, nil
+}
+
+// Schedule is a set of weekly time windows, such as
+// "Mon-Fri 08:00-18:00; Sat 09:00-13:00".
+type Schedule struct {
+	windows []window
+}
+
+type window struct {
+	days       [7]bool
+	start, end int // minutes since midnight
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule parses windows separated by ";" or ",". Each window is an
+// optional day or day range followed by a time range; without days it
+// applies every day. A range ending before it starts spans midnight and
+// belongs to the day it starts on.
+func ParseSchedule(s string) (*Schedule, error) {
+	sched := &Schedule{}
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == ',' }) {
+		fields := strings.Fields(part)
+		var w window
+		switch len(fields) {
+		case 1:
+			for d := range w.days {
+				w.days[d] = true
+			}
+		case 2:
+			if err := w.parseDays(fields[0]); err != nil {
+				return nil, err
+			}
+			fields = fields[1:]
+		default:
+			return nil, fmt.Errorf("invalid schedule window %q", strings.TrimSpace(part))
+		}
+		if err := w.parseTimes(fields[0]); err != nil {
+			return nil, err
+		}
+		sched.windows = append(sched.windows, w)
+	}
+	if len(sched.windows) == 0 {
+		return nil, fmt.Errorf("empty schedule")
+	}
+	return sched, nil
+}
+
+func (w *window) parseDays(s string) error {
+	from, to, isRange := strings.Cut(strings.ToLower(s), "-")
+	first, ok := weekdays[from]
+	if !ok {
+		return fmt.Errorf("invalid day %q", from)
+	}
+	last := first
+	if isRange {
+		if last, ok = weekdays[to]; !ok {
+			return fmt.Errorf("invalid day %q", to)
+		}
+	}
+	for d := first; ; d = (d + 1) % 7 {
+		w.days[d] = true
+		if d == last {
+			return nil
+		}
+	}
+}
+
+func (w *window) parseTimes(s string) error {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return fmt.Errorf("invalid time range %q", s)
+	}
+	var err error
+	if w.start, err = parseClock(from); err != nil {
+		return err
+	}
+	if w.end, err = parseClock(to); err != nil {
+		return err
+	}
+	if w.start == w.end {
+		return fmt.Errorf("empty time range %q", s)
+	}
+	return nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		if s == "24:00" {
+			return 24 * 60, nil
+		}
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Active reports whether t falls inside any window of the schedule.
+func (s *Schedule) Active(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+	for _, w := range s.windows {
+		if w.start < w.end {
+			if w.days[today] && minute >= w.start && minute < w.end {
+				return true
+			}
+			continue
+		}
+		// Overnight window.
+		if (w.days[today] && minute >= w.start) || (w.days[yesterday] && minute < w.end) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package throttle
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock advances time only when the limiter sleeps.
+type fakeClock struct {
+	now   time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) install(l *Limiter) {
+	l.now = func() time.Time { return c.now }
+	l.sleep = func(d time.Duration) {
+		c.slept += d
+		c.now = c.now.Add(d)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"1000", 1000, false},
+		{"512K", 512 << 10, false},
+		{"10M", 10 << 20, false},
+		{"10mb/s", 10 << 20, false},
+		{"1.5M", 3 << 19, false},
+		{"1G", 1 << 30, false},
+		{"fast", 0, true},
+		{"-1M", 0, true},
+		{"0", 0, false},
+		{"0.5", 0, true},
+		{"0.0000001K", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseRate(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLimiter_CapsThroughput(t *testing.T) {
+	l := New(1000, nil)
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	clock.install(l)
+
+	// The first second of data fits in the initial burst, the remaining
+	// 4000 bytes take four more seconds.
+	n, err := io.Copy(io.Discard, l.Reader(bytes.NewReader(make([]byte, 5000))))
+	if err != nil || n != 5000 {
+		t.Fatalf("Copy failed: %d bytes, %v", n, err)
+	}
+	if clock.slept < 3900*time.Millisecond || clock.slept > 4100*time.Millisecond {
+		t.Errorf("Expected about 4s of throttling, got %s", clock.slept)
+	}
+}
+
+func TestLimiter_SharedBetweenWriters(t *testing.T) {
+	l := New(1000, nil)
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	clock.install(l)
+
+	a, b := l.Writer(io.Discard), l.Writer(io.Discard)
+	for i := 0; i < 3; i++ {
+		a.Write(make([]byte, 1000))
+		b.Write(make([]byte, 1000))
+	}
+	if clock.slept < 4900*time.Millisecond {
+		t.Errorf("Expected both writers to share the limit, slept only %s", clock.slept)
+	}
+}
+
+func TestLimiter_OutsideSchedule(t *testing.T) {
+	sched, err := ParseSchedule("Mon-Fri 08:00-18:00")
+	if err != nil {
+		t.Fatalf("ParseSchedule failed: %v", err)
+	}
+	l := New(1000, sched)
+	// Saturday: no limit applies.
+	clock := &fakeClock{now: time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC)}
+	clock.install(l)
+
+	io.Copy(io.Discard, l.Reader(bytes.NewReader(make([]byte, 10000))))
+	if clock.slept != 0 {
+		t.Errorf("Expected no throttling outside the schedule, slept %s", clock.slept)
+	}
+}
+
+func TestLimiter_Nil(t *testing.T) {
+	var l *Limiter
+	l.Wait(1 << 30)
+	r := strings.NewReader("data")
+	if l.Reader(r) != io.Reader(r) {
+		t.Error("Expected a nil limiter to return the reader unchanged")
+	}
+}
+
+func TestSchedule_Active(t *testing.T) {
+	sched, err := ParseSchedule("Mon-Fri 08:00-18:00; Sat 22:00-02:00")
+	if err != nil {
+		t.Fatalf("ParseSchedule failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"monday morning", time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC), true},
+		{"friday evening", time.Date(2024, 1, 5, 17, 59, 0, 0, time.UTC), true},
+		{"friday after hours", time.Date(2024, 1, 5, 18, 0, 0, 0, time.UTC), false},
+		{"saturday night", time.Date(2024, 1, 6, 23, 0, 0, 0, time.UTC), true},
+		{"sunday early", time.Date(2024, 1, 7, 1, 30, 0, 0, time.UTC), true},
+		{"sunday noon", time.Date(2024, 1, 7, 12, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sched.Active(tt.at); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, s := range []string{"", "Mon-Fri", "Funday 08:00-18:00", "Mon 8-18", "Mon 08:00-08:00", "Mon Tue 08:00-09:00"} {
+		if _, err := ParseSchedule(s); err == nil {
+			t.Errorf("Expected error for %q", s)
+		}
+	}
+}
+
+func TestParseSchedule_EveryDay(t *testing.T) {
+	sched, err := ParseSchedule("08:00-18:00")
+	if err != nil {
+		t.Fatalf("ParseSchedule failed: %v", err)
+	}
+	if !sched.Active(time.Date(2024, 1, 7, 9, 0, 0, 0, time.UTC)) {
+		t.Error("Expected a window without days to apply on Sunday")
+	}
+}